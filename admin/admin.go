@@ -0,0 +1,243 @@
+// Package admin serves operational endpoints on a port of their own, kept
+// off the public listener and bound to the loopback interface unless
+// configured otherwise:
+//
+//	/debug/pprof/  net/http/pprof profiles
+//	/version       build information
+//	/flags         the CmdFlag values, secrets masked
+//	/config        the effective configuration, secrets masked
+//	/loglevel      GET the log level and the entries dropped by an async
+//	               logger, PUT {"level":"debug"} to change the level, or
+//	               {"logger":"db","level":"debug"} that of a named logger
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/tinklabs/golibs/cmd"
+	"github.com/tinklabs/golibs/config"
+	"github.com/tinklabs/golibs/log"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X github.com/tinklabs/golibs/admin.Version=1.2.0 -X github.com/tinklabs/golibs/admin.Commit=$(git rev-parse HEAD)"
+var (
+	Version   = "dev"
+	Commit    string
+	BuildTime string
+)
+
+// std is the admin server behind the package-level functions. It is nil
+// when the admin port is not configured.
+var std *Server
+
+// Options configures a Server created by New.
+type Options struct {
+	Port int
+	// Host is the interface listened on, 127.0.0.1 by default. Set
+	// Authorize when it is reachable from other hosts.
+	Host string
+	// Authorize rejects requests by returning an error, answered with 403.
+	// Every request is allowed when it is nil.
+	Authorize func(req *http.Request) error
+	// Flags are served at /flags, the default flags when nil.
+	Flags *cmd.CmdFlag
+	// Config returns the configuration served at /config, config.Data when
+	// nil.
+	Config func() map[string]interface{}
+	// Log is the logger whose level /loglevel controls, the default logger
+	// when nil.
+	Log *log.Log
+}
+
+// Server is the admin HTTP server.
+type Server struct {
+	opts   Options
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// New creates an admin server from opts.
+func New(opts Options) *Server {
+	s := &Server{opts: opts, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.mux.HandleFunc("/version", s.version)
+	s.mux.HandleFunc("/flags", s.flags)
+	s.mux.HandleFunc("/config", s.config)
+	s.mux.HandleFunc("/loglevel", s.logLevel)
+
+	return s
+}
+
+// Init creates the default admin server on the ADMIN_PORT read by
+// cmd.Init. It does nothing when the port is not set.
+func Init() {
+	cf := cmd.GetCmdFlag()
+	if cf == nil {
+		panic("init admin:cmd is not initialized")
+	}
+
+	if cf.AdminPort == 0 {
+		return
+	}
+
+	std = New(Options{Port: cf.AdminPort, Host: cf.AdminHost})
+}
+
+// Default returns the default admin server, or nil when it is disabled.
+func Default() *Server {
+	return std
+}
+
+// Start serves the default admin server, if any, until Stop is called.
+func Start() {
+	if std != nil {
+		std.Start()
+	}
+}
+
+// Stop shuts the default admin server down, if any.
+func Stop() {
+	if std != nil {
+		std.Stop()
+	}
+}
+
+// ServeHTTP lets s be used as an http.Handler, e.g. with httptest.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if s.opts.Authorize != nil {
+		if err := s.opts.Authorize(req); err != nil {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, req)
+}
+
+// Start serves until Stop is called.
+func (s *Server) Start() {
+	host := s.opts.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(host, strconv.Itoa(s.opts.Port)),
+		Handler: s,
+	}
+
+	log.Info("Admin server is listening on ", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error("admin server:", err)
+	}
+}
+
+// Stop gracefully shuts the server down.
+func (s *Server) Stop() {
+	if s.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Error("admin server shutdown:", err)
+	}
+}
+
+func (s *Server) logger() *log.Log {
+	if s.opts.Log != nil {
+		return s.opts.Log
+	}
+
+	return log.Default()
+}
+
+func (s *Server) version(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"version":   Version,
+		"commit":    Commit,
+		"buildTime": BuildTime,
+		"go":        runtime.Version(),
+	})
+}
+
+func (s *Server) flags(w http.ResponseWriter, req *http.Request) {
+	cf := s.opts.Flags
+	if cf == nil {
+		cf = cmd.GetCmdFlag()
+	}
+
+	writeJSON(w, http.StatusOK, maskStruct(cf))
+}
+
+func (s *Server) config(w http.ResponseWriter, req *http.Request) {
+	data := config.Data
+	if s.opts.Config != nil {
+		data = s.opts.Config()
+	}
+
+	writeJSON(w, http.StatusOK, mask(data))
+}
+
+func (s *Server) logLevel(w http.ResponseWriter, req *http.Request) {
+	l := s.logger()
+
+	switch req.Method {
+	case "GET":
+	case "PUT", "POST":
+		body := struct {
+			Logger string `json:"logger"`
+			Level  string `json:"level"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if body.Logger != "" {
+			n := log.Named(body.Logger)
+			old := n.Level()
+			if err := n.SetLevel(body.Level); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			log.Warn(fmt.Sprintf("log level of %s changed from %s to %s", body.Logger, old, n.Level()))
+			break
+		}
+
+		old := l.Level()
+		if err := l.SetLevel(body.Level); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		log.Warn(fmt.Sprintf("log level changed from %s to %s", old, l.Level()))
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"level": l.Level(), "levels": log.Levels(), "dropped": l.Dropped()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinklabs/golibs/cmd"
+	"github.com/tinklabs/golibs/log"
+)
+
+func TestAdmin(t *testing.T) {
+	l, err := log.New(log.Options{Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(Options{
+		Flags: &cmd.CmdFlag{ServerName: "rooms", ConsulAccessToken: "t0ken"},
+		Config: func() map[string]interface{} {
+			return map[string]interface{}{
+				"db":    map[string]interface{}{"url": "root:pa55@tcp(db:3306)/rooms"},
+				"cache": map[string]interface{}{"address": "redis:6379", "password": "pa55"},
+				// as read by auth.SigningKeys
+				"hmac_keys": map[string]interface{}{"booking": "s1gn"},
+			}
+		},
+		Log: l,
+	})
+
+	get := func(method, url, body string) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		if w.Code != 200 {
+			t.Errorf("%s %s: status %d", method, url, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if b := get("GET", "/flags", ""); strings.Contains(b, "t0ken") || !strings.Contains(b, `"ServerName":"rooms"`) {
+		t.Errorf("flags: %s", b)
+	}
+	if b := get("GET", "/config", ""); strings.Contains(b, "pa55") || strings.Contains(b, "s1gn") || !strings.Contains(b, "redis:6379") || !strings.Contains(b, "root:******@tcp") {
+		t.Errorf("config: %s", b)
+	}
+	if b := get("GET", "/version", ""); !strings.Contains(b, `"version":"dev"`) {
+		t.Errorf("version: %s", b)
+	}
+	if b := get("PUT", "/loglevel", `{"level":"warning"}`); !strings.Contains(b, "warning") || l.Level() != "warning" {
+		t.Errorf("loglevel: %s", b)
+	}
+	get("GET", "/debug/pprof/", "")
+
+	s.opts.Authorize = func(req *http.Request) error {
+		if req.Header.Get("X-Admin-Token") != "0k" {
+			return errors.New("admin token is required")
+		}
+		return nil
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Code != http.StatusForbidden || strings.Contains(w.Body.String(), "redis") {
+		t.Errorf("unauthorized config: %d %s", w.Code, w.Body)
+	}
+}
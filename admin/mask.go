@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"reflect"
+	"regexp"
+
+	"github.com/tinklabs/golibs/log"
+)
+
+const masked = "******"
+
+// dsnPassword matches the password of URLs and DSNs such as
+// user:pass@tcp(host)/db or redis://:pass@host.
+var dsnPassword = regexp.MustCompile(`([/\w.-]*:)[^:@/]+@`)
+
+// mask returns a copy of v with the values of secret keys replaced and the
+// passwords of URLs removed, at any depth.
+func mask(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			if log.IsSecret(k) && e != nil && e != "" {
+				m[k] = masked
+			} else {
+				m[k] = mask(e)
+			}
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = mask(e)
+		}
+		return l
+	case string:
+		return dsnPassword.ReplaceAllString(t, "${1}"+masked+"@")
+	}
+
+	return v
+}
+
+// maskStruct returns the exported fields of the struct v points to by name,
+// masked like mask.
+func maskStruct(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return m
+		}
+		rv = rv.Elem()
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		if f := rt.Field(i); f.PkgPath == "" {
+			m[f.Name] = rv.Field(i).Interface()
+		}
+	}
+
+	return mask(m).(map[string]interface{})
+}
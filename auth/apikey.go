@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tinklabs/golibs/config"
+	"github.com/tinklabs/golibs/consul"
+	"github.com/tinklabs/golibs/log"
+)
+
+// APIKeyHeader carries the API key of a request.
+const APIKeyHeader = "X-Api-Key"
+
+// KeyInfo describes the holder of an API key.
+type KeyInfo struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// KeyStore looks API keys up. Lookup returns nil for unknown keys.
+type KeyStore interface {
+	Lookup(key string) (*KeyInfo, error)
+}
+
+// Keys is a fixed set of API keys. Keys are held as SHA-256 digests so
+// lookups do not compare secrets byte by byte.
+type Keys map[string]*KeyInfo
+
+// NewKeys builds a set from plain keys.
+func NewKeys(keys map[string]*KeyInfo) Keys {
+	ks := Keys{}
+	for k, info := range keys {
+		ks[digest(k)] = info
+	}
+
+	return ks
+}
+
+func (ks Keys) Lookup(key string) (*KeyInfo, error) {
+	return ks[digest(key)], nil
+}
+
+// ParseKeys reads a JSON object of plain keys, e.g.
+//
+//	{"3f8a...": {"name": "pms", "scopes": ["rooms:read"]}}
+func ParseKeys(b []byte) (Keys, error) {
+	keys := map[string]*KeyInfo{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("parse api keys:%v", err)
+	}
+
+	return NewKeys(keys), nil
+}
+
+// ConfigKeys reads the keys under field, api_keys by default, of a
+// configuration.
+func ConfigKeys(cfg *config.Config, field string) (Keys, error) {
+	if field == "" {
+		field = "api_keys"
+	}
+
+	v, ok := cfg.Data[field]
+	if !ok {
+		return nil, fmt.Errorf("api keys:%s not exist", field)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("api keys:%v", err)
+	}
+
+	return ParseKeys(b)
+}
+
+// ConsulKeys reads the keys from a JSON document in the consul KV store and
+// reads it again every refresh. The last good keys are kept when consul
+// fails.
+type ConsulKeys struct {
+	cc      *consul.ConsulClient
+	path    string
+	refresh time.Duration
+
+	mu       sync.Mutex
+	keys     Keys
+	loadedAt time.Time
+}
+
+// NewConsulKeys reads the keys at path, b2c/<service>/apikeys by default,
+// every refresh, 1 minute by default.
+func NewConsulKeys(cc *consul.ConsulClient, path string, refresh time.Duration) *ConsulKeys {
+	if path == "" {
+		path = fmt.Sprintf("b2c/%s/apikeys", cc.ServerName)
+	}
+	if refresh <= 0 {
+		refresh = time.Minute
+	}
+
+	return &ConsulKeys{cc: cc, path: path, refresh: refresh}
+}
+
+// Lookup reads the keys again when they are older than refresh. One
+// request does so, outside the lock, while the others go on with the last
+// good keys.
+func (s *ConsulKeys) Lookup(key string) (*KeyInfo, error) {
+	s.mu.Lock()
+	keys := s.keys
+	load := keys == nil || time.Since(s.loadedAt) > s.refresh
+	if load {
+		s.loadedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if load {
+		loaded, err := s.load()
+		if err != nil {
+			if keys == nil {
+				return nil, err
+			}
+			log.Error(err)
+		} else {
+			s.mu.Lock()
+			s.keys, keys = loaded, loaded
+			s.mu.Unlock()
+		}
+	}
+
+	return keys.Lookup(key)
+}
+
+func (s *ConsulKeys) load() (Keys, error) {
+	pair, _, err := s.cc.KV.Get(s.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get api keys from consul:%v", err)
+	}
+	if pair == nil {
+		return nil, fmt.Errorf("get api keys from consul:%s not found", s.path)
+	}
+
+	return ParseKeys(pair.Value)
+}
+
+type apiKeyAuth struct {
+	store KeyStore
+}
+
+// APIKey authenticates requests with the key in the X-Api-Key header.
+func APIKey(store KeyStore) Authenticator {
+	return &apiKeyAuth{store: store}
+}
+
+func (a *apiKeyAuth) Authenticate(c *gin.Context) (*Principal, error) {
+	key := c.GetHeader(APIKeyHeader)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	info, err := a.store.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("api key is unknown")
+	}
+
+	return &Principal{Type: "apikey", Subject: info.Name, Scopes: info.Scopes}, nil
+}
+
+func digest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
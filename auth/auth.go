@@ -0,0 +1,112 @@
+// Package auth authenticates requests with JWTs or API keys and checks the
+// scopes of the authenticated principal per route.
+//
+//	jwt := auth.JWT(auth.JWTOptions{Keys: auth.NewJWKSURL(url, time.Hour)})
+//	keys := auth.APIKey(auth.NewConsulKeys(consul.GetConsulClient(), "", time.Minute))
+//	server.Register("v1", "POST", "/rooms", CreateRoom,
+//		server.Middleware(auth.Authenticate(jwt, keys), auth.Require("rooms:write")))
+package auth
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request does
+// not carry its kind of credentials, so the next one is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Type is "jwt", "apikey", "service" or "cert".
+	Type string
+	// Subject is the sub claim of a JWT, the name of an API key, the key ID
+	// of a signature or the common name of a client certificate.
+	Subject string
+	Scopes  []string
+	// Claims are the JWT claims, nil for other types.
+	Claims map[string]interface{}
+}
+
+func (p *Principal) String() string {
+	return p.Type + ":" + p.Subject
+}
+
+// HasScope reports whether p was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator finds and verifies one kind of credentials.
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*Principal, error)
+}
+
+// Authenticate returns a middleware trying each authenticator in turn and
+// storing the first principal in the context, where FromContext and the
+// access log find it. Requests without valid credentials are aborted with
+// ErrUnauthorized.
+func Authenticate(auths ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range auths {
+			p, err := a.Authenticate(c)
+			if err == ErrNoCredentials {
+				continue
+			}
+			if err != nil {
+				log.FromGin(c).Warn(err)
+				server.Abort(c, terr.ErrUnauthorized.AddExtra("invalid credentials"))
+				return
+			}
+
+			c.Set(log.PrincipalKey, p)
+			c.Next()
+			return
+		}
+
+		server.Abort(c, terr.ErrUnauthorized.AddExtra("credentials are required"))
+	}
+}
+
+// Require returns a middleware aborting with ErrForbidden unless the
+// principal has every scope. It must run after Authenticate.
+func Require(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := FromContext(c)
+		if p == nil {
+			server.Abort(c, terr.ErrUnauthorized.AddExtra("credentials are required"))
+			return
+		}
+
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				server.Abort(c, terr.ErrForbidden.AddExtra("scope "+s+" is required"))
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// FromContext returns the principal stored by Authenticate, or nil.
+func FromContext(c *gin.Context) *Principal {
+	if v, ok := c.Get(log.PrincipalKey); ok {
+		if p, ok := v.(*Principal); ok {
+			return p
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func TestJWTHS256(t *testing.T) {
+	v := JWT(JWTOptions{Secret: []byte("s3cret"), Issuer: "tink", Audience: "rooms"})
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	good := sign(t, "HS256", "", []byte("s3cret"), map[string]interface{}{"iss": "tink", "aud": []string{"rooms"}, "exp": exp})
+	if _, err := v.Verify(good); err != nil {
+		t.Errorf("good token: %v", err)
+	}
+
+	cases := map[string]string{
+		"bad secret": sign(t, "HS256", "", []byte("other"), map[string]interface{}{"iss": "tink", "aud": "rooms", "exp": exp}),
+		"expired":    sign(t, "HS256", "", []byte("s3cret"), map[string]interface{}{"iss": "tink", "aud": "rooms", "exp": 1}),
+		"issuer":     sign(t, "HS256", "", []byte("s3cret"), map[string]interface{}{"iss": "evil", "aud": "rooms", "exp": exp}),
+		"audience":   sign(t, "HS256", "", []byte("s3cret"), map[string]interface{}{"iss": "tink", "aud": "other", "exp": exp}),
+		"alg none":   b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{}`)) + ".",
+	}
+	for name, token := range cases {
+		if _, err := v.Verify(token); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestJWTRS256WithJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","n":%q,"e":%q}]}`,
+			b64(key.N.Bytes()), b64(big.NewInt(int64(key.E)).Bytes()))
+	}))
+	defer ts.Close()
+
+	v := JWT(JWTOptions{Keys: NewJWKSURL(ts.URL, time.Hour)})
+
+	token := sign(t, "RS256", "k1", key, map[string]interface{}{"sub": "u1", "scope": "rooms:read rooms:write"})
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "u1" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// An HS token signed with the public modulus must not pass as RS.
+	forged := sign(t, "HS256", "k1", key.N.Bytes(), map[string]interface{}{"sub": "u1"})
+	if _, err := v.Verify(forged); err == nil {
+		t.Error("forged token verified")
+	}
+}
+
+func TestJWKSFailingEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	keys := NewJWKSURL(ts.URL, time.Hour)
+
+	// Concurrent requests share one load, and later ones wait for
+	// minReload instead of loading again.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.Key("k1", "RS256"); err == nil {
+				t.Error("expected the load error")
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := keys.Key("k1", "RS256"); err == nil {
+		t.Error("expected the load error")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 1 {
+		t.Errorf("endpoint hit %d times", hits)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	keys := NewKeys(map[string]*KeyInfo{"k-read": {Name: "pms", Scopes: []string{"rooms:read"}}})
+	jwt := JWT(JWTOptions{Secret: []byte("s3cret")})
+
+	var principal string
+	r := gin.New()
+	r.GET("/rooms", Authenticate(jwt, APIKey(keys)), Require("rooms:read"), func(c *gin.Context) {
+		principal = FromContext(c).String()
+		c.String(http.StatusOK, "ok")
+	})
+	r.POST("/rooms", Authenticate(jwt, APIKey(keys)), Require("rooms:write"), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	call := func(method, header, value string) string {
+		req := httptest.NewRequest(method, "/rooms", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	if body := call("GET", "X-Api-Key", "k-read"); body != "ok" || principal != "apikey:pms" {
+		t.Errorf("api key: %q, principal %q", body, principal)
+	}
+
+	token := sign(t, "HS256", "", []byte("s3cret"), map[string]interface{}{"sub": "u1", "scp": []string{"rooms:read"}})
+	if body := call("GET", "Authorization", "Bearer "+token); body != "ok" || principal != "jwt:u1" {
+		t.Errorf("jwt: %q, principal %q", body, principal)
+	}
+
+	for name, body := range map[string]string{
+		"no credentials": call("GET", "", ""),
+		"unknown key":    call("GET", "X-Api-Key", "nope"),
+		"missing scope":  call("POST", "X-Api-Key", "k-read"),
+	} {
+		if body == "ok" {
+			t.Errorf("%s: request passed", name)
+		}
+	}
+
+	// The reason stays in the log, not in the answer.
+	if body := call("GET", "X-Api-Key", "nope"); !strings.Contains(body, "invalid credentials") || strings.Contains(body, "is unknown") {
+		t.Errorf("unknown key answered %s", body)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.POST("/rooms", VerifySignature(SignatureOptions{
+		Keys:   map[string][]byte{"booking": []byte("s3cret")},
+		Nonces: NewLocalNonces(),
+	}), func(c *gin.Context) {
+		c.String(http.StatusOK, FromContext(c).String())
+	})
+
+	body := []byte(`{"param":{}}`)
+	newReq := func(key []byte, ts int64) *http.Request {
+		req := httptest.NewRequest("POST", "/rooms?x=1", bytes.NewReader(body))
+		if err := SignRequest(req, body, "booking", key, ts); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	send := func(req *http.Request) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	req := newReq([]byte("s3cret"), now)
+	replay := *req
+	replay.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if got := send(req); got != "service:booking" {
+		t.Errorf("signed request: %q", got)
+	}
+	if got := send(&replay); !strings.Contains(got, "replayed") {
+		t.Errorf("replay: %q", got)
+	}
+	if got := send(newReq([]byte("other"), now)); !strings.Contains(got, "mismatch") {
+		t.Errorf("bad key: %q", got)
+	}
+	if got := send(newReq([]byte("s3cret"), now-int64(time.Hour/time.Millisecond))); !strings.Contains(got, "stale") {
+		t.Errorf("stale: %q", got)
+	}
+
+	// A captured envelope signed again with a fresh timestamp is refused.
+	for ts, want := range map[int64]string{now: "service:booking", now + 1: "does not match"} {
+		env := []byte(`{"common":{"msgType":"request","timestamp":` + strconv.FormatInt(now, 10) + `},"param":{}}`)
+		req := httptest.NewRequest("POST", "/rooms", bytes.NewReader(env))
+		if err := SignRequest(req, env, "booking", []byte("s3cret"), ts); err != nil {
+			t.Fatal(err)
+		}
+		if got := send(req); !strings.Contains(got, want) {
+			t.Errorf("envelope at %d: %q", ts-now, got)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/tinklabs/golibs/server"
+)
+
+type clientCertAuth struct{}
+
+// ClientCert authenticates mutual TLS requests by the common name of their
+// verified client certificate, see server.Options.ClientAuth.
+func ClientCert() Authenticator {
+	return clientCertAuth{}
+}
+
+func (clientCertAuth) Authenticate(c *gin.Context) (*Principal, error) {
+	cert := server.PeerCertificate(c)
+	if cert == nil {
+		return nil, ErrNoCredentials
+	}
+
+	return &Principal{Type: "cert", Subject: cert.Subject.CommonName}, nil
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tinklabs/golibs/log"
+)
+
+// minReload is the least time between two loads, so forged kids and a
+// failing key endpoint cannot make every request load the keys.
+const minReload = 10 * time.Second
+
+// JWKS is a JSON Web Key Set read from a file or a URL. RSA keys verify RS
+// tokens and oct keys verify HS tokens.
+type JWKS struct {
+	load    func() ([]byte, error)
+	refresh time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]interface{}
+	loadedAt time.Time
+	// loading is closed when the load in flight ends, nil without one.
+	loading chan struct{}
+	// err is the error of the last load.
+	err error
+}
+
+// NewJWKSFile reads the key set in path, again when a token names an
+// unknown key.
+func NewJWKSFile(path string) *JWKS {
+	return &JWKS{load: func() ([]byte, error) { return ioutil.ReadFile(path) }}
+}
+
+// NewJWKSURL fetches the key set at url, again every refresh and when a
+// token names an unknown key.
+func NewJWKSURL(url string, refresh time.Duration) *JWKS {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	return &JWKS{
+		refresh: refresh,
+		load: func() ([]byte, error) {
+			resp, err := client.Get(url)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("get %s:%s", url, resp.Status)
+			}
+
+			return ioutil.ReadAll(resp.Body)
+		},
+	}
+}
+
+func (s *JWKS) Key(kid, alg string) (interface{}, error) {
+	keys, err := s.current(kid)
+	if keys == nil {
+		return nil, err
+	}
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	// Tokens without kid are fine when the set has a single key.
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("jwt key %q is unknown", kid)
+}
+
+// current returns the keys, loading them first when they are stale or miss
+// kid. One load runs at a time, outside the lock, and at most one per
+// minReload. Callers with keys do not wait for it; the others do.
+func (s *JWKS) current(kid string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	keys, err := s.keys, s.err
+	_, known := keys[kid]
+	stale := keys == nil || !known || (s.refresh > 0 && time.Since(s.loadedAt) > s.refresh)
+	if !stale || (s.loading == nil && time.Since(s.loadedAt) < minReload) {
+		s.mu.Unlock()
+		return keys, err
+	}
+
+	if wait := s.loading; wait != nil {
+		s.mu.Unlock()
+		if keys != nil {
+			return keys, nil
+		}
+
+		<-wait
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.keys, s.err
+	}
+
+	done := make(chan struct{})
+	s.loading, s.loadedAt = done, time.Now()
+	s.mu.Unlock()
+
+	loaded, err := s.reload()
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = loaded
+	}
+	s.err, s.loading = err, nil
+	keys = s.keys
+	s.mu.Unlock()
+	close(done)
+
+	if err != nil && keys != nil {
+		log.Error(err)
+	}
+
+	return keys, err
+}
+
+func (s *JWKS) reload() (map[string]interface{}, error) {
+	b, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("load jwks:%v", err)
+	}
+
+	return ParseJWKS(b)
+}
+
+// ParseJWKS returns the RSA and oct keys of a key set by key ID.
+func ParseJWKS(b []byte) (map[string]interface{}, error) {
+	set := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks:%v", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("parse jwks key %s:%v", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("parse jwks key %s:%v", k.Kid, err)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("parse jwks key %s:%v", k.Kid, err)
+			}
+			keys[k.Kid] = secret
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeySource finds the key verifying a JWT: a []byte secret for HS
+// algorithms or an *rsa.PublicKey for RS algorithms.
+type KeySource interface {
+	Key(kid, alg string) (interface{}, error)
+}
+
+// JWTOptions configures a JWTVerifier.
+type JWTOptions struct {
+	// Secret verifies HS256, HS384 and HS512 tokens.
+	Secret []byte
+	// Keys verifies RS256, RS384 and RS512 tokens, and HS tokens when it
+	// holds symmetric keys.
+	Keys KeySource
+	// Issuer and Audience are checked against the iss and aud claims when
+	// set.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew on exp and nbf.
+	Leeway time.Duration
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// JWTVerifier authenticates requests with a bearer JWT in the
+// Authorization header.
+type JWTVerifier struct {
+	opts JWTOptions
+	now  func() time.Time
+}
+
+// JWT returns a verifier for opts.
+func JWT(opts JWTOptions) *JWTVerifier {
+	return &JWTVerifier{opts: opts, now: time.Now}
+}
+
+func (v *JWTVerifier) Authenticate(c *gin.Context) (*Principal, error) {
+	h := c.GetHeader("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := v.Verify(strings.TrimSpace(h[len("Bearer "):]))
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Principal{Type: "jwt", Subject: sub, Scopes: scopes(claims), Claims: claims}, nil
+}
+
+// Verify checks the signature and the time, issuer and audience claims of
+// token and returns its claims.
+func (v *JWTVerifier) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("jwt is malformed")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("jwt header:%v", err)
+	}
+
+	hash, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("jwt alg %q is not supported", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("jwt signature:%v", err)
+	}
+
+	key, err := v.key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := verifySignature(header.Alg, hash, key, signed, sig); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("jwt claims:%v", err)
+	}
+
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) key(kid, alg string) (interface{}, error) {
+	if v.opts.Keys != nil {
+		key, err := v.opts.Keys.Key(kid, alg)
+		if err == nil || v.opts.Secret == nil || !strings.HasPrefix(alg, "HS") {
+			return key, err
+		}
+	}
+
+	if strings.HasPrefix(alg, "HS") && v.opts.Secret != nil {
+		return v.opts.Secret, nil
+	}
+
+	return nil, fmt.Errorf("no key for jwt alg %s", alg)
+}
+
+// verifySignature checks sig with a key of the type alg requires, so an RS
+// public key can never be used as an HS secret.
+func verifySignature(alg string, hash crypto.Hash, key interface{}, signed, sig []byte) error {
+	h := hash.New()
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("jwt key for %s is not a secret", alg)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("jwt signature is invalid")
+		}
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwt key for %s is not an rsa public key", alg)
+		}
+		h.Write(signed)
+		if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), sig); err != nil {
+			return fmt.Errorf("jwt signature is invalid")
+		}
+	}
+
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := v.now()
+
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(v.opts.Leeway)) {
+			return fmt.Errorf("jwt is expired")
+		}
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(v.opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return fmt.Errorf("jwt is not valid yet")
+		}
+	}
+
+	if v.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.opts.Issuer {
+			return fmt.Errorf("jwt issuer %q is not accepted", iss)
+		}
+	}
+
+	if v.opts.Audience != "" && !hasAudience(claims["aud"], v.opts.Audience) {
+		return fmt.Errorf("jwt audience is not accepted")
+	}
+
+	return nil
+}
+
+func hasAudience(aud interface{}, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []interface{}:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// scopes reads the space separated scope claim, or the scp or scopes
+// claims as lists or strings.
+func scopes(claims map[string]interface{}) []string {
+	for _, name := range []string{"scope", "scp", "scopes"} {
+		switch v := claims[name].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			ss := make([]string, 0, len(v))
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					ss = append(ss, s)
+				}
+			}
+			return ss
+		}
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
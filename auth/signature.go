@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+
+	"github.com/tinklabs/golibs/cache"
+	"github.com/tinklabs/golibs/config"
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+	"github.com/tinklabs/golibs/utils"
+)
+
+// Headers of signed requests.
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureKeyHeader       = "X-Signature-Key"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+)
+
+// SignRequest signs req, whose body is body, as service keyID with key. The
+// signature is an HMAC-SHA256 over the method, the path and query, the
+// timestamp in ms, a nonce and the SHA-256 of the body. ts must be the
+// Common.Timestamp of the envelope, if any, or VerifySignature rejects the
+// request.
+func SignRequest(req *http.Request, body []byte, keyID string, key []byte, ts int64) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	req.Header.Set(SignatureKeyHeader, keyID)
+	req.Header.Set(SignatureTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureNonceHeader, hex.EncodeToString(nonce))
+	req.Header.Set(SignatureHeader, signature(req, body, key))
+
+	return nil
+}
+
+func signature(req *http.Request, body []byte, key []byte) string {
+	bodySum := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(),
+		req.Header.Get(SignatureTimestampHeader), req.Header.Get(SignatureNonceHeader), hex.EncodeToString(bodySum[:]))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NonceStore remembers the nonces of recent requests.
+type NonceStore interface {
+	// Seen records nonce for ttl and reports whether it was already there.
+	Seen(nonce string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonces keeps nonces in redis, so a replay to any instance of the
+// service is caught.
+type RedisNonces struct {
+	client redis.Cmdable
+}
+
+// NewRedisNonces keeps nonces in client, or in cache.Client when client is
+// nil.
+func NewRedisNonces(client redis.Cmdable) *RedisNonces {
+	return &RedisNonces{client: client}
+}
+
+func (s *RedisNonces) Seen(nonce string, ttl time.Duration) (bool, error) {
+	c := s.client
+	if c == nil {
+		c = cache.Client
+	}
+	if c == nil {
+		return false, fmt.Errorf("nonce:cache is not initialized")
+	}
+
+	ok, err := c.SetNX("nonce:"+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("nonce:%v", err)
+	}
+
+	return !ok, nil
+}
+
+// LocalNonces keeps nonces in process memory, for tests and single
+// instance services.
+type LocalNonces struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewLocalNonces() *LocalNonces {
+	return &LocalNonces{nonces: map[string]time.Time{}}
+}
+
+func (s *LocalNonces) Seen(nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for n, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, n)
+		}
+	}
+
+	if _, ok := s.nonces[nonce]; ok {
+		return true, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+
+	return false, nil
+}
+
+// SignatureOptions configures VerifySignature.
+type SignatureOptions struct {
+	// Keys are the signing keys by service name.
+	Keys map[string][]byte
+	// MaxSkew is how far the timestamp may be from now, 5 minutes by
+	// default. Nonces are kept twice as long.
+	MaxSkew time.Duration
+	// Nonces is a RedisNonces on cache.Client by default.
+	Nonces NonceStore
+}
+
+// VerifySignature returns a middleware aborting requests that are not
+// signed by a known service, are stale or are replayed, with ErrSignature.
+// The calling service becomes the principal, as "service:<name>".
+func VerifySignature(opts SignatureOptions) gin.HandlerFunc {
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = 5 * time.Minute
+	}
+	if opts.Nonces == nil {
+		opts.Nonces = NewRedisNonces(nil)
+	}
+
+	return func(c *gin.Context) {
+		if err := verify(c, opts); err != nil {
+			log.FromGin(c).Warn(err)
+			server.Abort(c, err)
+			return
+		}
+
+		c.Set(log.PrincipalKey, &Principal{Type: "service", Subject: c.GetHeader(SignatureKeyHeader)})
+		c.Next()
+	}
+}
+
+func verify(c *gin.Context, opts SignatureOptions) *terr.TError {
+	req := c.Request
+
+	key, ok := opts.Keys[req.Header.Get(SignatureKeyHeader)]
+	if !ok {
+		return terr.ErrSignature.AddExtra("unknown key")
+	}
+
+	ts, err := strconv.ParseInt(req.Header.Get(SignatureTimestampHeader), 10, 64)
+	if err != nil {
+		return terr.ErrSignature.AddExtra("timestamp is required")
+	}
+	skew := time.Duration(utils.GetNowTs()-ts) * time.Millisecond
+	if skew > opts.MaxSkew || -skew > opts.MaxSkew {
+		return terr.ErrSignature.AddExtra("timestamp is stale")
+	}
+
+	nonce := req.Header.Get(SignatureNonceHeader)
+	if nonce == "" {
+		return terr.ErrSignature.AddExtra("nonce is required")
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return terr.ErrSignature.AddExtra("read body failed")
+	}
+	req.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	want := signature(req, body, key)
+	if !hmac.Equal([]byte(want), []byte(req.Header.Get(SignatureHeader))) {
+		return terr.ErrSignature.AddExtra("signature mismatch")
+	}
+
+	// The signed header stands for the timestamp of the envelope, so a
+	// captured body cannot be sent again with a fresh header.
+	env := struct {
+		Common *struct {
+			Timestamp int64 `json:"timestamp"`
+		} `json:"common"`
+	}{}
+	if json.Unmarshal(body, &env) == nil && env.Common != nil && env.Common.Timestamp != ts {
+		return terr.ErrSignature.AddExtra("timestamp does not match the envelope")
+	}
+
+	// Only signed nonces are recorded, so forged requests cannot burn them.
+	seen, err := opts.Nonces.Seen(nonce, 2*opts.MaxSkew)
+	if err != nil {
+		log.Error(err)
+		return terr.ErrServer
+	}
+	if seen {
+		return terr.ErrSignature.AddExtra("request is replayed")
+	}
+
+	return nil
+}
+
+// SigningKeys reads the service signing keys under field, hmac_keys by
+// default, of a configuration, e.g. {"hmac_keys": {"booking": "s3cret"}}.
+func SigningKeys(cfg *config.Config, field string) (map[string][]byte, error) {
+	if field == "" {
+		field = "hmac_keys"
+	}
+
+	v, ok := cfg.Data[field]
+	if !ok {
+		return nil, fmt.Errorf("signing keys:%s not exist", field)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("signing keys:%v", err)
+	}
+
+	keys := map[string]string{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("signing keys:%v", err)
+	}
+
+	rv := make(map[string][]byte, len(keys))
+	for name, key := range keys {
+		rv[name] = []byte(key)
+	}
+
+	return rv, nil
+}
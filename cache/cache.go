@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/go-redis/redis"
@@ -11,16 +12,102 @@ var (
 	Client *redis.Client
 )
 
+// Config describes a redis connection.
+type Config struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// Init connects the default client with the address from the default
+// configuration.
 func Init() {
 	addr, pw := config.TakeCacheAddressAndPassword()
-	Client = redis.NewClient(&redis.Options{
+	c, err := New(Config{
 		Addr:     addr,
 		Password: pw, // no password set
 		DB:       0,  // use default DB
 	})
-
-	_, err := Client.Ping().Result()
 	if err != nil {
 		panic(fmt.Sprintf("init cache:%v", err))
 	}
+
+	Client = c
+}
+
+// New connects a redis client and checks it with a ping.
+func New(cfg Config) (*redis.Client, error) {
+	c := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	if _, err := c.Ping().Result(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// WithContext returns the default client bound to ctx. Its commands and
+// pipelines fail with ctx.Err() once ctx is done, without being sent.
+//
+// go-redis v6 cannot cancel a command already sent: it stays bounded by the
+// ReadTimeout and WriteTimeout of the client, which are shared by the pool
+// and so not shortened to the deadline of ctx.
+func WithContext(ctx context.Context) *redis.Client {
+	return withContext(Client, ctx)
+}
+
+func withContext(c *redis.Client, ctx context.Context) *redis.Client {
+	c = c.WithContext(ctx)
+	c.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			if d := refused[ctx.Err()]; d != nil {
+				return d.Process(cmd)
+			}
+			return process(cmd)
+		}
+	})
+	c.WrapProcessPipeline(func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			if d := refused[ctx.Err()]; d != nil {
+				pipe := d.Pipeline()
+				for _, cmd := range cmds {
+					pipe.Process(cmd)
+				}
+				_, err := pipe.Exec()
+				return err
+			}
+			return process(cmds)
+		}
+	})
+
+	return c
 }
+
+// refused are clients failing every command with the error of a done
+// context, as go-redis only lets its own client set the error of a
+// command. They never connect.
+var refused = map[error]*redis.Client{
+	context.Canceled:         refusing(context.Canceled),
+	context.DeadlineExceeded: refusing(context.DeadlineExceeded),
+}
+
+func refusing(err error) *redis.Client {
+	c := redis.NewClient(&redis.Options{IdleCheckFrequency: -1})
+	return c.SetLimiter(errLimiter{err})
+}
+
+// errLimiter refuses every command with err.
+type errLimiter struct {
+	err error
+}
+
+func (l errLimiter) Allow() error {
+	return l.err
+}
+
+func (l errLimiter) ReportResult(error) {}
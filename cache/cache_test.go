@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestWithContext(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	c, err := New(Config{Addr: mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cc := withContext(c, ctx)
+	if err := cc.Set("k", "v", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := cc.Get("k").Err(); err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	pipe := cc.Pipeline()
+	get := pipe.Get("k")
+	if _, err := pipe.Exec(); err != context.Canceled || get.Err() != context.Canceled {
+		t.Errorf("pipeline err = %v, %v", err, get.Err())
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if err := withContext(c, deadline).Get("k").Err(); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The client it came from is not affected.
+	if v, err := c.Get("k").Result(); err != nil || v != "v" {
+		t.Errorf("get = %q, %v", v, err)
+	}
+}
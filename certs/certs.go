@@ -0,0 +1,240 @@
+// Package certs loads TLS certificates from files or the consul KV store
+// and reloads them while serving, so rotated certificates are picked up
+// without a restart.
+//
+//	store, err := certs.New(certs.Files{Cert: "tls.crt", Key: "tls.key", CA: "ca.crt"}, time.Minute)
+//	s := server.New(server.Options{TLS: store, ClientAuth: tls.RequireAndVerifyClientCert})
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/tinklabs/golibs/consul"
+	"github.com/tinklabs/golibs/log"
+)
+
+// Bundle is a PEM encoded certificate chain, its private key and an
+// optional CA bundle verifying peers.
+type Bundle struct {
+	Cert []byte
+	Key  []byte
+	CA   []byte
+}
+
+// Source loads a bundle.
+type Source interface {
+	Load() (*Bundle, error)
+}
+
+// Files reads a bundle from files. CA may be empty.
+type Files struct {
+	Cert string
+	Key  string
+	CA   string
+}
+
+func (f Files) Load() (*Bundle, error) {
+	b := &Bundle{}
+
+	var err error
+	if b.Cert, err = ioutil.ReadFile(f.Cert); err != nil {
+		return nil, fmt.Errorf("read certificate:%v", err)
+	}
+	if b.Key, err = ioutil.ReadFile(f.Key); err != nil {
+		return nil, fmt.Errorf("read key:%v", err)
+	}
+	if f.CA != "" {
+		if b.CA, err = ioutil.ReadFile(f.CA); err != nil {
+			return nil, fmt.Errorf("read ca:%v", err)
+		}
+	}
+
+	return b, nil
+}
+
+// Consul reads a bundle from the keys cert, key and ca under a prefix of
+// the consul KV store. ca may be missing.
+type Consul struct {
+	cc     *consul.ConsulClient
+	prefix string
+}
+
+// NewConsul reads the bundle under prefix, b2c/<service>/tls by default.
+func NewConsul(cc *consul.ConsulClient, prefix string) *Consul {
+	if prefix == "" {
+		prefix = fmt.Sprintf("b2c/%s/tls", cc.ServerName)
+	}
+
+	return &Consul{cc: cc, prefix: prefix}
+}
+
+func (s *Consul) Load() (*Bundle, error) {
+	get := func(name string, required bool) ([]byte, error) {
+		key := s.prefix + "/" + name
+		pair, _, err := s.cc.KV.Get(key, nil)
+		if err != nil {
+			return nil, fmt.Errorf("get %s from consul:%v", key, err)
+		}
+		if pair == nil {
+			if required {
+				return nil, fmt.Errorf("get %s from consul:not found", key)
+			}
+			return nil, nil
+		}
+
+		return pair.Value, nil
+	}
+
+	b := &Bundle{}
+
+	var err error
+	if b.Cert, err = get("cert", true); err != nil {
+		return nil, err
+	}
+	if b.Key, err = get("key", true); err != nil {
+		return nil, err
+	}
+	if b.CA, err = get("ca", false); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Store holds the certificate and CA pool of a source, loading them again
+// every refresh in the background, so handshakes never wait for the
+// source. The last good bundle is kept when the source fails.
+type Store struct {
+	src Source
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+
+	once sync.Once
+	stop chan struct{}
+}
+
+// New loads the bundle of src, which must be valid. A zero refresh never
+// reloads it; otherwise Close stops reloading.
+func New(src Source, refresh time.Duration) (*Store, error) {
+	s := &Store{src: src, stop: make(chan struct{})}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	if refresh > 0 {
+		go s.run(refresh)
+	}
+
+	return s, nil
+}
+
+func (s *Store) run(refresh time.Duration) {
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.reload(); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+// Close stops reloading the bundle.
+func (s *Store) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Store) reload() error {
+	b, err := s.src.Load()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.X509KeyPair(b.Cert, b.Key)
+	if err != nil {
+		return fmt.Errorf("parse certificate:%v", err)
+	}
+
+	var pool *x509.CertPool
+	if len(b.CA) > 0 {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b.CA) {
+			return fmt.Errorf("parse ca:no certificate found")
+		}
+	}
+
+	s.mu.Lock()
+	s.cert, s.pool = &cert, pool
+	s.mu.Unlock()
+
+	return nil
+}
+
+// current returns the certificate and CA pool loaded last.
+func (s *Store) current() (*tls.Certificate, *x509.CertPool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cert, s.pool
+}
+
+// ServerConfig returns a TLS config serving the certificate of s. Client
+// certificates are verified against the CA bundle of s according to
+// clientAuth; without a CA bundle none verifies. Only verified
+// certificates appear in the VerifiedChains of a connection, the others,
+// as accepted by tls.RequestClientCert and tls.RequireAnyClientCert, are
+// never trusted by server.PeerCertificate.
+func (s *Store) ServerConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := s.current()
+			return cert, nil
+		},
+		// crypto/tls verifies against the fixed ClientCAs pool of a config,
+		// so every handshake gets a config with the current bundle.
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := s.current()
+			if pool == nil {
+				// A nil pool would verify against the system roots.
+				pool = x509.NewCertPool()
+			}
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				ClientAuth:   clientAuth,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a TLS config presenting the certificate of s to
+// servers asking for one. Servers are verified against the CA bundle of s
+// as loaded now, or the system roots without one.
+func (s *Store) ClientConfig() *tls.Config {
+	_, pool := s.current()
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := s.current()
+			return cert, nil
+		},
+	}
+}
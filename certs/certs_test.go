@@ -0,0 +1,166 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue returns a PEM certificate and key for cn, self-signed when ca is
+// nil.
+func issue(t *testing.T, ca *issuer, cn string, usage x509.ExtKeyUsage) (*issuer, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &issuer{cert: cert, key: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func write(t *testing.T, dir string, files map[string][]byte) {
+	for name, b := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caPEM, _ := issue(t, nil, "ca", x509.ExtKeyUsageAny)
+	_, srvCert, srvKey := issue(t, ca, "server-1", x509.ExtKeyUsageServerAuth)
+	_, cliCert, cliKey := issue(t, ca, "booking", x509.ExtKeyUsageClientAuth)
+	write(t, dir, map[string][]byte{"srv.crt": srvCert, "srv.key": srvKey, "ca.crt": caPEM, "cli.crt": cliCert, "cli.key": cliKey})
+
+	srvStore, err := New(Files{Cert: filepath.Join(dir, "srv.crt"), Key: filepath.Join(dir, "srv.key"), CA: filepath.Join(dir, "ca.crt")}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srvStore.Close()
+	cliStore, err := New(Files{Cert: filepath.Join(dir, "cli.crt"), Key: filepath.Join(dir, "cli.key"), CA: filepath.Join(dir, "ca.crt")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(clientAuth tls.ClientAuthType) (*httptest.Server, string) {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.VerifiedChains) == 0 {
+				w.Write([]byte("unverified"))
+				return
+			}
+			w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+		}))
+		// StartTLS would install its own certificate.
+		ts.Listener = tls.NewListener(ts.Listener, srvStore.ServerConfig(clientAuth))
+		ts.Start()
+		return ts, "https://" + ts.Listener.Addr().String()
+	}
+
+	ts, url := serve(tls.RequireAndVerifyClientCert)
+	defer ts.Close()
+
+	get := func(cfg *tls.Config) (string, string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := c.Get(url)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b), resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	peer, server, err := get(cliStore.ClientConfig())
+	if err != nil || peer != "booking" || server != "server-1" {
+		t.Fatalf("peer %q, server %q, err %v", peer, server, err)
+	}
+
+	if _, _, err := get(&tls.Config{RootCAs: cliStore.ClientConfig().RootCAs}); err == nil {
+		t.Error("request without client certificate succeeded")
+	}
+
+	// A self-signed certificate is refused, and never verified when only
+	// requested.
+	_, selfCert, selfKey := issue(t, nil, "booking", x509.ExtKeyUsageClientAuth)
+	self, err := tls.X509KeyPair(selfCert, selfKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfCfg := &tls.Config{
+		RootCAs: cliStore.ClientConfig().RootCAs,
+		// Certificates would only be sent when issued by an accepted CA.
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &self, nil },
+	}
+	if _, _, err := get(selfCfg); err == nil {
+		t.Error("request with self-signed certificate succeeded")
+	}
+
+	anyTS, anyURL := serve(tls.RequireAnyClientCert)
+	url = anyURL
+	if peer, _, err := get(selfCfg); err != nil || peer != "unverified" {
+		t.Errorf("require any: peer %q, err %v", peer, err)
+	}
+	anyTS.Close()
+	url = "https://" + ts.Listener.Addr().String()
+
+	_, srvCert, srvKey = issue(t, ca, "server-2", x509.ExtKeyUsageServerAuth)
+	write(t, dir, map[string][]byte{"srv.crt": srvCert, "srv.key": srvKey})
+	time.Sleep(20 * time.Millisecond)
+
+	if _, server, err := get(cliStore.ClientConfig()); err != nil || server != "server-2" {
+		t.Errorf("after rotation: server %q, err %v", server, err)
+	}
+}
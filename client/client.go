@@ -1 +1,147 @@
+// Package client calls other services with the standard request envelope.
 package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tinklabs/golibs/auth"
+	"github.com/tinklabs/golibs/certs"
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+	"github.com/tinklabs/golibs/utils"
+)
+
+// Options configures a Client.
+type Options struct {
+	// Name identifies the calling service in signatures.
+	Name string
+	// Key signs requests with HMAC when set, see auth.SignRequest.
+	Key []byte
+	// Timeout bounds each call, 10s by default.
+	Timeout time.Duration
+	// Certs presents its client certificate to servers asking for one, and
+	// verifies them against its CA bundle.
+	Certs *certs.Store
+	// HTTPClient sends the requests. A client with Timeout and Certs is
+	// created when it is nil.
+	HTTPClient *http.Client
+}
+
+// Client sends request envelopes and decodes response envelopes.
+type Client struct {
+	opts Options
+	http *http.Client
+}
+
+// New creates a client from opts.
+func New(opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	hc := opts.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: opts.Timeout}
+		if opts.Certs != nil {
+			hc.Transport = &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: opts.Certs.ClientConfig(),
+			}
+		}
+	}
+
+	return &Client{opts: opts, http: hc}
+}
+
+// Call sends param in a request envelope to url and decodes the data of
+// the response into data, if data is not nil. A response with an error
+// code is returned as a *terr.TError carrying that code. The deadline of
+// ctx is sent in server.TimeoutHeader.
+func (c *Client) Call(ctx context.Context, method, url string, param interface{}, data interface{}) error {
+	if param == nil {
+		param = map[string]interface{}{}
+	}
+
+	ts := utils.GetNowTs()
+	body, err := json.Marshal(map[string]interface{}{
+		"common": &server.Common{MsgType: "request", Timestamp: ts},
+		"param":  param,
+	})
+	if err != nil {
+		return fmt.Errorf("encode request:%v", err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Keep the trace and request IDs of the calling request.
+	f := log.FromContext(ctx).Fields()
+	if id, ok := f["trace-id"].(string); ok {
+		req.Header.Set(log.TraceHeader, id)
+	}
+	if id, ok := f["request-id"].(string); ok && id != "" {
+		req.Header.Set("Request-Id", id)
+	}
+
+	// Tell the callee how long we wait, so it gives up when we do.
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return ctx.Err()
+		}
+		req.Header.Set(server.TimeoutHeader, strconv.FormatInt(int64(left/time.Millisecond), 10))
+	}
+
+	if c.opts.Key != nil {
+		if err := auth.SignRequest(req, body, c.opts.Name, c.opts.Key, ts); err != nil {
+			return fmt.Errorf("sign request:%v", err)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	r := struct {
+		server.Response
+		Data json.RawMessage `json:"data,omitempty"`
+	}{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return fmt.Errorf("decode response(%s):%v", resp.Status, err)
+	}
+
+	if r.ErrorCode != 0 {
+		e := &terr.TError{Code: r.ErrorCode, Desc: r.ErrorMsg}
+		if resp.StatusCode != http.StatusOK {
+			e.Status = resp.StatusCode
+		}
+		return e
+	}
+
+	if data != nil && len(r.Data) > 0 {
+		if err := json.Unmarshal(r.Data, data); err != nil {
+			return fmt.Errorf("decode data:%v", err)
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,72 @@
 package client
 
 import (
-	"github.com/tinklabs/golibs/cmd"
-	"github.com/tinklabs/golibs/consul"
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tinklabs/golibs/auth"
+	terr "github.com/tinklabs/golibs/error"
 	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
 )
 
-func init() {
-	cmd.Init()
-	log.Init()
-	consul.Init()
+func TestCall(t *testing.T) {
+	l, err := log.New(log.Options{Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.New(server.Options{Name: "rooms", Log: l})
+	s.Register("v1", "POST", "/timeout", func(c *gin.Context) {
+		server.OK(c, c.GetHeader(server.TimeoutHeader))
+	})
+	s.Register("v1", "POST", "/who", func(c *gin.Context) {
+		if c.GetStringMap("param")["fail"] == true {
+			server.Fail(c, terr.ErrRequest)
+			return
+		}
+		server.OK(c, map[string]string{"caller": auth.FromContext(c).Subject})
+	}, server.Middleware(auth.VerifySignature(auth.SignatureOptions{
+		Keys:   map[string][]byte{"booking": []byte("s3cret")},
+		Nonces: auth.NewLocalNonces(),
+	})))
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := New(Options{Name: "booking", Key: []byte("s3cret")})
+
+	data := map[string]string{}
+	if err := c.Call(context.Background(), "POST", ts.URL+"/api/rooms/v1/who", nil, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data["caller"] != "booking" {
+		t.Errorf("data = %v", data)
+	}
+
+	err = c.Call(context.Background(), "POST", ts.URL+"/api/rooms/v1/who", map[string]bool{"fail": true}, nil)
+	if e, ok := err.(*terr.TError); !ok || e.Code != terr.ErrRequest.Code {
+		t.Errorf("err = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var left string
+	if err := New(Options{}).Call(ctx, "POST", ts.URL+"/api/rooms/v1/timeout", nil, &left); err != nil {
+		t.Fatal(err)
+	}
+	if ms, _ := strconv.Atoi(left); ms <= 0 || ms > 60000 {
+		t.Errorf("timeout header = %q", left)
+	}
+
+	unsigned := New(Options{})
+	err = unsigned.Call(context.Background(), "POST", ts.URL+"/api/rooms/v1/who", nil, nil)
+	if e, ok := err.(*terr.TError); !ok || e.Code != terr.ErrSignature.Code {
+		t.Errorf("unsigned err = %v", err)
+	}
 }
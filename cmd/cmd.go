@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
+	"github.com/tinklabs/golibs/metadata"
 	"github.com/tinklabs/golibs/utils"
 )
 
@@ -17,15 +19,52 @@ type CmdFlag struct {
 	ConsulAddress     string
 	ConsulPort        string
 	ConsulAccessToken string
+	StatusMapping     bool
+	// Docs serves the OpenAPI document of the routes on the server port.
+	Docs bool
+	// TLSCertFile, TLSKeyFile and TLSCAFile serve HTTPS when TLSCertFile is
+	// set. TLSFromConsul reads them from consul instead.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCAFile     string
+	TLSFromConsul bool
+	// TLSClientAuth is none, optional or require.
+	TLSClientAuth string
+	// AdminPort serves the admin endpoints when it is not zero, on the
+	// AdminHost interface, 127.0.0.1 by default.
+	AdminPort int
+	AdminHost string
 }
 
 var cmdFlag *CmdFlag
 
+// Init loads the .env files of the working directory, reads the flags from
+// the environment and installs them as the package default returned by
+// GetCmdFlag.
 func Init() {
+	if err := LoadEnvFiles("."); err != nil {
+		panic(fmt.Sprintf("load env files:%v", err))
+	}
+
+	cf, err := New()
+	if err != nil {
+		panic(fmt.Sprintf("init cmd:%v", err))
+	}
+
+	cmdFlag = cf
+}
+
+// New reads the flags from the environment. It fails if a required
+// variable is missing or malformed, or if the consul address cannot be
+// read from the metadata service in production.
+func New() (*CmdFlag, error) {
 	var port int
 	var debug, dontCheck bool
 
-	serverName := GetEnvPanic("SERVER_NAME")
+	serverName := GetEnvWithDefault("SERVER_NAME", "")
+	if serverName == "" {
+		return nil, fmt.Errorf("SERVER_NAME not provided")
+	}
 	profileEnv := GetEnvWithDefault("PROFILE_ENV", "dev")
 	consulAddress := GetEnvWithDefault("CONSUL_ADDRESS", "http://127.0.0.1")
 	consulPort := GetEnvWithDefault("CONSUL_PORT", "8500")
@@ -37,7 +76,12 @@ func Init() {
 		dontCheck = true
 	}
 
-	serverAddress := GetEnvWithDefault("SERVER_ADDRESS", utils.GetIntranetIp(dontCheck))
+	// GetIntranetIp panics without an intranet address, so it only runs
+	// when SERVER_ADDRESS is not given.
+	serverAddress := GetEnvWithDefault("SERVER_ADDRESS", "")
+	if serverAddress == "" {
+		serverAddress = utils.GetIntranetIp(dontCheck)
+	}
 
 	if GetEnvWithDefault("DEBUG", "true") == "false" {
 		debug = false
@@ -47,34 +91,98 @@ func Init() {
 
 	port, err := strconv.Atoi(GetEnvWithDefault("SERVER_PORT", "8080"))
 	if err != nil {
-		panic(fmt.Sprintf("server port:%v", err))
+		return nil, fmt.Errorf("server port:%v", err)
 	}
 
+	statusMapping := GetEnvWithDefault("HTTP_STATUS_MAPPING", "false") == "true"
+
+	adminPort, err := strconv.Atoi(GetEnvWithDefault("ADMIN_PORT", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("admin port:%v", err)
+	}
+
+	tlsFromConsul := GetEnvWithDefault("TLS_FROM_CONSUL", "false") == "true"
+
 	if GetEnvWithDefault("RANDOM_PORT", "false") == "true" {
 		port = utils.GetPort()
 	}
 
 	if profileEnv == "production" {
-		consulAddress = utils.GetConsulAddressFromMetadata()
+		if consulAddress, err = consulAddressFromMetadata(); err != nil {
+			return nil, err
+		}
 	}
 
-	cmdFlag = &CmdFlag{
+	return &CmdFlag{
 		Debug:             debug,
+		Env:               profileEnv,
 		ServerName:        serverName,
 		ServerAddress:     serverAddress,
 		ServerPort:        port,
 		ConsulAddress:     consulAddress,
 		ConsulPort:        consulPort,
 		ConsulAccessToken: consulAccessToken,
-	}
+		StatusMapping:     statusMapping,
+		Docs:              GetEnvWithDefault("SERVE_DOCS", "false") == "true",
+		TLSCertFile:       GetEnvWithDefault("TLS_CERT_FILE", ""),
+		TLSKeyFile:        GetEnvWithDefault("TLS_KEY_FILE", ""),
+		TLSCAFile:         GetEnvWithDefault("TLS_CA_FILE", ""),
+		TLSFromConsul:     tlsFromConsul,
+		TLSClientAuth:     GetEnvWithDefault("TLS_CLIENT_AUTH", "none"),
+		AdminPort:         adminPort,
+		AdminHost:         GetEnvWithDefault("ADMIN_HOST", "127.0.0.1"),
+	}, nil
 }
 
+// GetCmdFlag returns the package default flags, or nil before Init.
 func GetCmdFlag() *CmdFlag {
 	return cmdFlag
 }
 
+// SetCmdFlag replaces the package default flags.
+func SetCmdFlag(cf *CmdFlag) {
+	cmdFlag = cf
+}
+
+// IsDebug reports whether the default flags enable debug mode. It is false
+// before Init.
 func IsDebug() bool {
-	return cmdFlag.Debug
+	return cmdFlag != nil && cmdFlag.Debug
+}
+
+// consulAddressFromMetadata asks the metadata service selected by
+// METADATA_PROVIDER (aws, gcp, url or static) for the address of the host,
+// where the local consul agent listens.
+func consulAddressFromMetadata() (string, error) {
+	opts := metadata.Options{BaseURL: GetEnvWithDefault("METADATA_URL", "")}
+
+	if v := GetEnvWithDefault("METADATA_TIMEOUT", ""); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return "", fmt.Errorf("metadata timeout:%v", err)
+		}
+		opts.Timeout = d
+	}
+
+	if v := GetEnvWithDefault("METADATA_RETRIES", ""); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "", fmt.Errorf("metadata retries:%v", err)
+		}
+		opts.Retries = n
+	}
+
+	p, err := metadata.New(GetEnvWithDefault("METADATA_PROVIDER", "aws"), opts)
+	if err != nil {
+		return "", fmt.Errorf("metadata provider:%v", err)
+	}
+
+	ip, err := p.LocalIPv4()
+	if err != nil {
+		return "", fmt.Errorf("get meta:%v", err)
+	}
+
+	return fmt.Sprintf("http://%s", ip), nil
 }
 
 func GetEnvWithDefault(env, option string) string {
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// setenv sets vars and returns a function restoring the environment.
+func setenv(vars map[string]string) func() {
+	old := map[string]*string{}
+	for k, v := range vars {
+		if o, ok := os.LookupEnv(k); ok {
+			old[k] = &o
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestNewMetadata(t *testing.T) {
+	up := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("10.0.0.1"))
+	}))
+	defer ts.Close()
+
+	defer setenv(map[string]string{
+		"SERVER_NAME":       "rooms",
+		"SERVER_ADDRESS":    "127.0.0.1",
+		"PROFILE_ENV":       "production",
+		"METADATA_PROVIDER": "url",
+		"METADATA_URL":      ts.URL,
+		"METADATA_RETRIES":  "-1",
+	})()
+
+	cf, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf.ConsulAddress != "http://10.0.0.1" {
+		t.Errorf("consul address = %s", cf.ConsulAddress)
+	}
+
+	up = false
+	if _, err := New(); err == nil {
+		t.Error("expected the metadata error")
+	}
+}
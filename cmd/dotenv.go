@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadEnvFiles reads <dir>/.env and then <dir>/.env.<PROFILE_ENV> and sets
+// every variable they define that is not already in the environment, so
+// real environment variables always win and the profile file overrides the
+// base file. PROFILE_ENV itself may come from the base file. Missing files
+// are skipped.
+func LoadEnvFiles(dir string) error {
+	vars := map[string]string{}
+	lookup := func(key string) (string, bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := vars[key]
+		return v, ok
+	}
+
+	if err := readEnvFile(filepath.Join(dir, ".env"), vars, lookup); err != nil {
+		return err
+	}
+
+	if profile, ok := lookup("PROFILE_ENV"); ok && profile != "" {
+		if err := readEnvFile(filepath.Join(dir, ".env."+profile), vars, lookup); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range vars {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readEnvFile(name string, vars map[string]string, lookup func(string) (string, bool)) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := ParseEnv(f, vars, lookup); err != nil {
+		return fmt.Errorf("%s:%v", name, err)
+	}
+
+	return nil
+}
+
+// ParseEnv reads KEY=VALUE lines into vars. Blank lines, # comments and an
+// optional "export " prefix are allowed. Values may be unquoted, 'single
+// quoted' (taken literally) or "double quoted" (with \n, \t, \" and \\
+// escapes). Unquoted and double-quoted values expand $VAR, ${VAR} and
+// ${VAR:-default} through lookup; \$ is a literal dollar.
+func ParseEnv(r io.Reader, vars map[string]string, lookup func(string) (string, bool)) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return fmt.Errorf("line %d:expected KEY=VALUE", n)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		value, err := parseEnvValue(strings.TrimSpace(line[i+1:]), lookup)
+		if err != nil {
+			return fmt.Errorf("line %d:%v", n, err)
+		}
+
+		vars[key] = value
+	}
+
+	return scanner.Err()
+}
+
+func parseEnvValue(raw string, lookup func(string) (string, bool)) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return expandEnv(b.String(), lookup), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '$':
+					// keep the escape for expandEnv
+					b.WriteString(`\$`)
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quote")
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+
+	return expandEnv(raw, lookup), nil
+}
+
+func expandEnv(s string, lookup func(string) (string, bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		if s[i+1] == '{' {
+			end := strings.Index(s[i:], "}")
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			name, def := s[i+2:i+end], ""
+			hasDef := false
+			if j := strings.Index(name, ":-"); j >= 0 {
+				name, def, hasDef = name[:j], name[j+2:], true
+			}
+			v, ok := lookup(name)
+			if hasDef && (!ok || v == "") {
+				v = def
+			}
+			b.WriteString(v)
+			i += end
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && isEnvNameByte(s[j]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte(c)
+			continue
+		}
+		v, _ := lookup(s[i+1 : j])
+		b.WriteString(v)
+		i = j - 1
+	}
+
+	return b.String()
+}
+
+func isEnvNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	src := `
+# comment
+export HOST=db.local
+PORT=3306 # inline comment
+URL=mysql://${HOST}:$PORT/app
+RAW='$HOST'
+QUOTED="a\tb ${MISSING:-fallback} \$HOST"
+`
+	vars := map[string]string{}
+	lookup := func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+	if err := ParseEnv(strings.NewReader(src), vars, lookup); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"HOST":   "db.local",
+		"PORT":   "3306",
+		"URL":    "mysql://db.local:3306/app",
+		"RAW":    "$HOST",
+		"QUOTED": "a\tb fallback $HOST",
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+}
+
+func TestLoadEnvFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("PROFILE_ENV=staging\nDOTENV_A=base\nDOTENV_B=base\nDOTENV_C=base\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".env.staging"), []byte("DOTENV_B=staging\nDOTENV_C=${DOTENV_B}\n"), 0644)
+
+	os.Unsetenv("PROFILE_ENV")
+	os.Setenv("DOTENV_A", "real")
+	defer func() {
+		for _, k := range []string{"PROFILE_ENV", "DOTENV_A", "DOTENV_B", "DOTENV_C"} {
+			os.Unsetenv(k)
+		}
+	}()
+
+	if err := LoadEnvFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]string{"DOTENV_A": "real", "DOTENV_B": "staging", "DOTENV_C": "staging"} {
+		if got := os.Getenv(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
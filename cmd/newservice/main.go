@@ -0,0 +1,40 @@
+// Command newservice generates the skeleton of a service built on golibs.
+//
+//	go run github.com/tinklabs/golibs/cmd/newservice -name hotel-room -module github.com/tinklabs/hotel-room
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tinklabs/golibs/scaffold"
+)
+
+func main() {
+	opts := scaffold.Options{}
+	flag.StringVar(&opts.Name, "name", "", "service name, e.g. hotel-room (required)")
+	flag.StringVar(&opts.Module, "module", "", "go module path (default: the service name)")
+	flag.StringVar(&opts.Dir, "dir", "", "output directory (default: ./<name>)")
+	flag.Parse()
+
+	if opts.Name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	created, err := scaffold.Generate(opts)
+	for _, p := range created {
+		fmt.Println("create", p)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = opts.Name
+	}
+	fmt.Println("\nnext: cd", dir, "&& go mod tidy && go test ./...")
+}
@@ -4,31 +4,67 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/tinklabs/golibs/cmd"
 	"github.com/tinklabs/golibs/consul"
 )
 
+// Data is the default configuration read by Init.
 var Data map[string]interface{}
 
+// Config is a service configuration document.
+type Config struct {
+	Data map[string]interface{}
+}
+
+// Init loads the default configuration through the default consul client.
 func Init() {
-	cf := cmd.GetCmdFlag()
-	cc := consul.GetConsulClient()
+	c, err := Load(consul.GetConsulClient())
+	if err != nil {
+		panic(err.Error())
+	}
+
+	Data = c.Data
+}
+
+// New wraps an already decoded configuration document.
+func New(data map[string]interface{}) *Config {
+	return &Config{Data: data}
+}
+
+// Load reads the JSON document stored under b2c/<service>/config in the
+// consul KV store.
+func Load(cc *consul.ConsulClient) (*Config, error) {
+	if cc == nil {
+		return nil, fmt.Errorf("get configuration from consul:consul is not initialized")
+	}
 
 	// Lookup the pair
-	configPath := fmt.Sprintf("b2c/%s/config", cf.ServerName)
+	configPath := fmt.Sprintf("b2c/%s/config", cc.ServerName)
 	pair, _, err := cc.KV.Get(configPath, nil)
 	if err != nil {
-		panic(fmt.Sprintf("get configuration from consul:%v", err))
+		return nil, fmt.Errorf("get configuration from consul:%v", err)
+	}
+	if pair == nil {
+		return nil, fmt.Errorf("get configuration from consul:%s not found", configPath)
 	}
 
-	err = json.Unmarshal(pair.Value, &Data)
-	if err != nil {
-		panic(fmt.Sprintf("config is not json:%v", err))
+	c := &Config{}
+	if err := json.Unmarshal(pair.Value, &c.Data); err != nil {
+		return nil, fmt.Errorf("config is not json:%v", err)
 	}
+
+	return c, nil
 }
 
 func TakeDbUrl() string {
-	if v, isExist := Data["db_url"]; isExist {
+	return New(Data).TakeDbUrl()
+}
+
+func TakeCacheAddressAndPassword() (addr string, pw string) {
+	return New(Data).TakeCacheAddressAndPassword()
+}
+
+func (c *Config) TakeDbUrl() string {
+	if v, isExist := c.Data["db_url"]; isExist {
 		if v, ok := v.(string); ok {
 			return v
 		} else {
@@ -39,8 +75,8 @@ func TakeDbUrl() string {
 	}
 }
 
-func TakeCacheAddressAndPassword() (addr string, pw string) {
-	if v, isExist := Data["redis_address"]; isExist {
+func (c *Config) TakeCacheAddressAndPassword() (addr string, pw string) {
+	if v, isExist := c.Data["redis_address"]; isExist {
 		if v, ok := v.(string); ok {
 			addr = v
 		} else {
@@ -50,7 +86,7 @@ func TakeCacheAddressAndPassword() (addr string, pw string) {
 		panic("redis address not exist")
 	}
 
-	if v, isExist := Data["redis_password"]; isExist {
+	if v, isExist := c.Data["redis_password"]; isExist {
 		if v, ok := v.(string); ok {
 			pw = v
 		} else {
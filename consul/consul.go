@@ -2,12 +2,12 @@ package consul
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	consul "github.com/hashicorp/consul/api"
 
 	"github.com/tinklabs/golibs/cmd"
-	"github.com/tinklabs/golibs/log"
 	"github.com/tinklabs/golibs/utils"
 )
 
@@ -22,46 +22,69 @@ type ConsulClient struct {
 	Agent         *consul.Agent
 	Health        *consul.Health
 	KV            *consul.KV
+
+	stop chan struct{}
+	// initialLevels are the log levels before the first Register, restored
+	// when the key at LogLevelKey is deleted.
+	initialLevels     string
+	initialLevelsOnce sync.Once
 }
 
+// GetConsulClient returns the default client, or nil before Init.
 func GetConsulClient() *ConsulClient {
 	return cc
 }
 
+// SetConsulClient replaces the default client.
+func SetConsulClient(c *ConsulClient) {
+	cc = c
+}
+
+// Init creates the default client from the flags read by cmd.Init.
 func Init() {
-	cf := cmd.GetCmdFlag()
+	c, err := New(cmd.GetCmdFlag())
+	if err != nil {
+		panic(fmt.Sprintf("init consul:%v", err))
+	}
+
+	cc = c
+}
+
+// New creates a client for the agent and service described by cf.
+func New(cf *cmd.CmdFlag) (*ConsulClient, error) {
+	if cf == nil {
+		return nil, fmt.Errorf("cmd is not initialized")
+	}
 
 	dc := consul.DefaultConfig()
 	dc.Token = cf.ConsulAccessToken
 	dc.Address = fmt.Sprintf("%s:%s", cf.ConsulAddress, cf.ConsulPort)
 	c, err := consul.NewClient(dc)
 	if err != nil {
-		panic(fmt.Sprintf("new consul client:%v", err))
+		return nil, fmt.Errorf("new consul client:%v", err)
 	}
 
-	agent := c.Agent()
-	health := c.Health()
-	kv := c.KV()
-
 	uuid, err := utils.UUID()
 	if err != nil {
-		panic(fmt.Sprintf("generate uuid:%v", err))
+		return nil, fmt.Errorf("generate uuid:%v", err)
 	}
 
 	id := fmt.Sprintf("%s-%s", cf.ServerName, uuid)
 
-	cc = &ConsulClient{
+	return &ConsulClient{
 		ServerID:      id,
 		ServerName:    cf.ServerName,
 		ServerAddress: cf.ServerAddress,
 		ServerPort:    cf.ServerPort,
 		TTL:           time.Second * 30,
-		Agent:         agent,
-		Health:        health,
-		KV:            kv,
-	}
+		Agent:         c.Agent(),
+		Health:        c.Health(),
+		KV:            c.KV(),
+	}, nil
 }
 
+// Register registers the service, then keeps its TTL check passing and
+// applies the log levels at LogLevelKey until Deregister.
 func (c *ConsulClient) Register() {
 	def := &consul.AgentServiceRegistration{
 		ID:      c.ServerID,
@@ -74,24 +97,38 @@ func (c *ConsulClient) Register() {
 		},
 	}
 
-	if err := cc.Agent.ServiceRegister(def); err != nil {
+	if err := c.Agent.ServiceRegister(def); err != nil {
 		panic(fmt.Sprintf("register:%v", err))
 	}
-	log.Info("Register service:" + c.ServerID)
+	logger.Info("Register service:" + c.ServerID)
 
-	go c.updateTTL()
+	c.stop = make(chan struct{})
+	go c.updateTTL(c.stop)
+	go c.watchLogLevels(c.stop)
 }
 
-func (c *ConsulClient) updateTTL() {
+func (c *ConsulClient) updateTTL(stop chan struct{}) {
 	ticker := time.NewTicker(c.TTL / 2)
-	for range ticker.C {
-		if err := c.Agent.UpdateTTL("service:"+c.ServerID, "I'm alive", "pass"); err != nil {
-			log.Error(err)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.Agent.UpdateTTL("service:"+c.ServerID, "I'm alive", "pass"); err != nil {
+				logger.Error(err)
+			}
 		}
 	}
 }
 
 func (c *ConsulClient) Deregister() error {
-	log.Info("Deregister service:" + c.ServerID)
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+
+	logger.Info("Deregister service:" + c.ServerID)
 	return c.Agent.ServiceDeregister(c.ServerID)
 }
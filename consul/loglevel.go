@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"github.com/tinklabs/golibs/log"
+)
+
+// logger is the named logger of the consul package.
+var logger = log.Named("consul")
+
+// LogLevelKey returns the KV key holding the log levels of the service,
+// b2c/<service>/loglevel, in the format of log.SetLevels, e.g.
+// "info,db=debug".
+func (c *ConsulClient) LogLevelKey() string {
+	return fmt.Sprintf("b2c/%s/loglevel", c.ServerName)
+}
+
+// watchLogLevels applies the levels at LogLevelKey whenever they change,
+// until stop is closed. The levels in effect when it first starts come back
+// when the key is deleted, also after the service registers again.
+func (c *ConsulClient) watchLogLevels(stop chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	key := c.LogLevelKey()
+	c.initialLevelsOnce.Do(func() { c.initialLevels = log.Levels() })
+	initial := c.initialLevels
+	// The first value is always applied: the levels of a previous watch
+	// may still be in effect.
+	applied, first := "", true
+
+	var index uint64
+	for {
+		opts := &consul.QueryOptions{WaitIndex: index, WaitTime: 5 * time.Minute}
+		pair, meta, err := c.KV.Get(key, opts.WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("watch log levels at %s:%v", key, err))
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+
+		// The index goes back when the KV store is restored, start over.
+		if meta.LastIndex < index {
+			index = 0
+			continue
+		}
+		index = meta.LastIndex
+
+		value := ""
+		if pair != nil {
+			value = strings.TrimSpace(string(pair.Value))
+		}
+		if value == applied && !first {
+			continue
+		}
+		applied, first = value, false
+
+		old := log.Levels()
+		if err := log.SetLevels(initial + "," + value); err != nil {
+			logger.Error(fmt.Sprintf("log levels at %s:%v", key, err))
+			continue
+		}
+		if levels := log.Levels(); levels != old {
+			logger.Warn(fmt.Sprintf("log levels changed from %s to %s", old, levels))
+		}
+	}
+}
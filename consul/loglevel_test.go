@@ -0,0 +1,119 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+
+	"github.com/tinklabs/golibs/log"
+)
+
+// fakeKV answers blocking queries on a single key like a consul agent.
+type fakeKV struct {
+	mu      sync.Mutex
+	index   uint64
+	value   []byte
+	changed chan struct{}
+}
+
+func (f *fakeKV) set(value []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.index++
+	f.value = value
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	f.mu.Lock()
+	if index >= f.index {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Second):
+		}
+		f.mu.Lock()
+	}
+	index, value := f.index, f.value
+	f.mu.Unlock()
+
+	w.Header().Set("X-Consul-Index", fmt.Sprint(index))
+	if value == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode([]*consul.KVPair{{Key: "b2c/svc/loglevel", Value: value, ModifyIndex: index}})
+}
+
+func waitLevels(t *testing.T, want string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for log.Levels() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("levels = %s, want %s", log.Levels(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchLogLevels(t *testing.T) {
+	kv := &fakeKV{index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	api, err := consul.NewClient(&consul.Config{Address: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ConsulClient{ServerName: "svc", KV: api.KV()}
+
+	if err := log.SetLevels("info"); err != nil {
+		t.Fatal(err)
+	}
+	defer log.SetLevels("info")
+
+	watch := func() func() {
+		stop, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			c.watchLogLevels(stop)
+			close(done)
+		}()
+		return func() {
+			close(stop)
+			<-done
+		}
+	}
+
+	stop := watch()
+	kv.set([]byte("debug,db=warn"))
+	waitLevels(t, "debug,db=warning")
+
+	// A bad value leaves the levels alone.
+	kv.set([]byte("verbose"))
+	time.Sleep(100 * time.Millisecond)
+	waitLevels(t, "debug,db=warning")
+
+	kv.set([]byte("warn"))
+	waitLevels(t, "warning")
+	stop()
+
+	// After registering again, deleting the key restores the levels from
+	// before the first watch, not those applied from the key.
+	stop = watch()
+	defer stop()
+	kv.set(nil)
+	waitLevels(t, "info")
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ContextKey is the gorm setting holding the context of a handle returned
+// by WithContext.
+const ContextKey = "golibs:context"
+
+// WithContext returns a handle on d whose statements are refused with
+// ctx.Err() once ctx is done, e.g. when the request deadline passes:
+//
+//	db.WithContext(c.Request.Context(), db.DB).Find(&users)
+//
+// gorm v1 runs statements without a context, so a statement already sent
+// runs to its end; use Transaction to have database/sql roll back on the
+// deadline. The check is a callback installed by Open, and does not cover
+// Exec and Row.
+func WithContext(ctx context.Context, d *gorm.DB) *gorm.DB {
+	return d.Set(ContextKey, ctx)
+}
+
+// Transaction runs fn in a transaction bound to ctx: its statements are
+// refused like those of WithContext, and database/sql rolls it back once
+// ctx is done. The transaction is committed when fn returns nil and rolled
+// back otherwise, also when fn panics.
+func Transaction(ctx context.Context, d *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	tx := d.BeginTx(ctx, &sql.TxOptions{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	done := false
+	defer func() {
+		if !done {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(WithContext(ctx, tx)); err != nil {
+		return err
+	}
+
+	done = true
+	return tx.Commit().Error
+}
+
+// registerContext installs the callbacks refusing the statements of
+// handles whose context is done.
+func registerContext(d *gorm.DB) {
+	cb := d.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register(ContextKey, checkContext)
+	cb.Update().Before("gorm:begin_transaction").Register(ContextKey, checkContext)
+	cb.Delete().Before("gorm:begin_transaction").Register(ContextKey, checkContext)
+	cb.Query().Before("gorm:query").Register(ContextKey, checkContext)
+	cb.RowQuery().Before("gorm:row_query").Register(ContextKey, checkContext)
+}
+
+func checkContext(scope *gorm.Scope) {
+	v, ok := scope.Get(ContextKey)
+	if !ok {
+		return
+	}
+	ctx, ok := v.(context.Context)
+	if !ok || ctx.Err() == nil {
+		return
+	}
+
+	// A *sql.Row cannot carry the error; Row runs as usual.
+	if r, ok := scope.InstanceGet("row_query_result"); ok {
+		rows, ok := r.(*gorm.RowsQueryResult)
+		if !ok {
+			return
+		}
+		rows.Error = ctx.Err()
+	}
+
+	scope.Err(ctx.Err())
+	scope.SkipLeft()
+}
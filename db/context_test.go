@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// recorder is a database/sql driver counting queries and transactions.
+type recorder struct {
+	queries, commits, rollbacks int
+}
+
+func (r *recorder) Open(string) (driver.Conn, error) { return r, nil }
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) { return r, nil }
+func (r *recorder) Driver() driver.Driver                        { return r }
+
+func (r *recorder) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (r *recorder) Close() error                        { return nil }
+func (r *recorder) Begin() (driver.Tx, error) {
+	return r.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (r *recorder) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return recorderTx{r}, nil
+}
+
+func (r *recorder) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r.queries++
+	return emptyRows{}, nil
+}
+
+type recorderTx struct{ r *recorder }
+
+func (t recorderTx) Commit() error   { t.r.commits++; return nil }
+func (t recorderTx) Rollback() error { t.r.rollbacks++; return nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return []string{"id"} }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+type user struct{ ID int }
+
+func open(t *testing.T) (*gorm.DB, *recorder) {
+	rec := &recorder{}
+	d, err := gorm.Open("mysql", sql.OpenDB(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerContext(d)
+
+	return d, rec
+}
+
+func TestWithContext(t *testing.T) {
+	d, rec := open(t)
+
+	var users []user
+	if err := WithContext(context.Background(), d.Where("id = ?", 1)).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WithContext(canceled, d).Find(&users).Error; err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if _, err := WithContext(canceled, d).Table("users").Rows(); err != context.Canceled {
+		t.Errorf("rows err = %v, want %v", err, context.Canceled)
+	}
+	if rec.queries != 1 {
+		t.Errorf("%d queries sent, want 1", rec.queries)
+	}
+
+	// d itself is not bound to the context.
+	if err := d.Find(&users).Error; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	d, rec := open(t)
+
+	var users []user
+	if err := Transaction(context.Background(), d, func(tx *gorm.DB) error {
+		return tx.Find(&users).Error
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.commits != 1 || rec.queries != 1 {
+		t.Errorf("commits %d, queries %d", rec.commits, rec.queries)
+	}
+
+	// The deadline passing inside the transaction refuses the next
+	// statements and rolls it back.
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Transaction(ctx, d, func(tx *gorm.DB) error {
+		cancel()
+		return tx.Find(&users).Error
+	})
+	if err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if rec.rollbacks != 1 || rec.queries != 1 {
+		t.Errorf("rollbacks %d, queries %d", rec.rollbacks, rec.queries)
+	}
+}
@@ -14,15 +14,34 @@ var (
 	DB *gorm.DB
 )
 
+// Config describes a database connection.
+type Config struct {
+	URL   string
+	Debug bool
+}
+
+// Init opens the default connection with the url from the default
+// configuration.
 func Init() {
-	db, err := gorm.Open("mysql", config.TakeDbUrl())
+	db, err := Open(Config{URL: config.TakeDbUrl(), Debug: cmd.IsDebug()})
 	if err != nil {
 		panic(fmt.Sprintf("open db:%v", err))
 	}
 
 	DB = db
+}
 
-	if cmd.IsDebug() {
-		DB.LogMode(true)
+// Open opens a mysql connection whose handles honour WithContext.
+func Open(cfg Config) (*gorm.DB, error) {
+	db, err := gorm.Open("mysql", cfg.URL)
+	if err != nil {
+		return nil, err
 	}
+
+	if cfg.Debug {
+		db.LogMode(true)
+	}
+	registerContext(db)
+
+	return db, nil
 }
@@ -3,12 +3,39 @@ package error
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"sync"
 )
 
 type TError struct {
 	Code  int    `json:"code"`
 	Desc  string `json:"desc"`
 	Extra string `json:"extra,omitempty"`
+	// Status is the HTTP status sent when the server maps errors to
+	// statuses. The range of Code decides when it is zero.
+	Status int `json:"-"`
+}
+
+// statusRanges maps the range of a code, its ten-thousands digit, to an
+// HTTP status: 1xxxx server errors to 500, 2xxxx request errors to 400, and
+// 3xxxx service errors, where the codes of scaffolded services start, to
+// 400. Codes out of every range map to 500.
+var statusRanges = struct {
+	sync.RWMutex
+	m map[int]int
+}{m: map[int]int{
+	1: http.StatusInternalServerError,
+	2: http.StatusBadRequest,
+	3: http.StatusBadRequest,
+}}
+
+// RegisterStatusRange maps the codes from rng*10000 to rng*10000+9999 to
+// an HTTP status, e.g. RegisterStatusRange(4, http.StatusConflict).
+func RegisterStatusRange(rng, status int) {
+	statusRanges.Lock()
+	defer statusRanges.Unlock()
+
+	statusRanges.m[rng] = status
 }
 
 func (e *TError) Error() string {
@@ -17,10 +44,17 @@ func (e *TError) Error() string {
 }
 
 var (
-	ErrServer = &TError{Code: 10000, Desc: "server internal error"}
-	ErrConsul = &TError{Code: 10001, Desc: "consul error"}
+	ErrServer  = &TError{Code: 10000, Desc: "server internal error"}
+	ErrConsul  = &TError{Code: 10001, Desc: "consul error"}
+	ErrTimeout = &TError{Code: 10002, Desc: "request timed out", Status: http.StatusGatewayTimeout}
 
-	ErrRequest = &TError{Code: 20000, Desc: "request params is incorrect"}
+	ErrRequest              = &TError{Code: 20000, Desc: "request params is incorrect"}
+	ErrRateLimited          = &TError{Code: 20001, Desc: "too many requests", Status: http.StatusTooManyRequests}
+	ErrUnauthorized         = &TError{Code: 20002, Desc: "unauthorized", Status: http.StatusUnauthorized}
+	ErrForbidden            = &TError{Code: 20003, Desc: "forbidden", Status: http.StatusForbidden}
+	ErrSignature            = &TError{Code: 20004, Desc: "signature is invalid", Status: http.StatusUnauthorized}
+	ErrIdempotencyInFlight  = &TError{Code: 20005, Desc: "request with the same idempotency key is in progress", Status: http.StatusConflict}
+	ErrIdempotencyKeyReused = &TError{Code: 20006, Desc: "idempotency key was used with another request", Status: http.StatusUnprocessableEntity}
 )
 
 func (e *TError) AddExtra(extra string) (err *TError) {
@@ -41,3 +75,30 @@ func (e *TError) Message() (msg string) {
 
 	return msg
 }
+
+// WithStatus returns a copy of e answered with the HTTP status when status
+// mapping is on.
+func (e *TError) WithStatus(status int) (err *TError) {
+	temp := *e
+
+	err = &temp
+	err.Status = status
+
+	return err
+}
+
+// HTTPStatus returns Status, or else the status of the range of Code.
+func (e *TError) HTTPStatus() int {
+	if e.Status != 0 {
+		return e.Status
+	}
+
+	statusRanges.RLock()
+	status, ok := statusRanges.m[e.Code/10000]
+	statusRanges.RUnlock()
+	if ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
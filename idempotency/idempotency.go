@@ -0,0 +1,190 @@
+// Package idempotency replays the first response of a mutating request to
+// its retries, keyed by the Idempotency-Key header.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// Record is a stored response.
+type Record struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+	// Fingerprint is the SHA-256 of the query string and request body.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Options configures the middleware returned by New.
+type Options struct {
+	// TTL is how long responses are replayed, 24h by default.
+	TTL time.Duration
+	// LockTTL bounds how long a request is considered in flight, in case
+	// its instance dies before answering. 1 minute by default.
+	LockTTL time.Duration
+	// Store is a Redis store on cache.Client by default.
+	Store Store
+}
+
+// New returns a middleware for POST, PUT and PATCH routes. The first
+// request with a given Idempotency-Key runs; its response is stored unless
+// it is a server error, and replayed to later requests with the same key,
+// path, query and caller. A request arriving while the first is in flight gets
+// ErrIdempotencyInFlight, and one reusing the key with another body gets
+// ErrIdempotencyKeyReused.
+func New(opts Options) gin.HandlerFunc {
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = time.Minute
+	}
+	if opts.Store == nil {
+		opts.Store = NewRedis(nil)
+	}
+
+	return func(c *gin.Context) {
+		idem := c.GetHeader(Header)
+		m := c.Request.Method
+		if idem == "" || (m != "POST" && m != "PUT" && m != "PATCH") {
+			c.Next()
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			log.Warn(err)
+			server.Abort(c, terr.ErrRequest.AddExtra("read body failed"))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		sum := sha256.Sum256(append([]byte(c.Request.URL.RawQuery+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+		key := storeKey(c, idem)
+
+		acquired, rec, err := opts.Store.Begin(key, opts.LockTTL)
+		if err != nil {
+			// Without the store the request runs unprotected rather than
+			// failing.
+			log.Error(err)
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			switch {
+			case rec == nil:
+				server.Abort(c, terr.ErrIdempotencyInFlight)
+			case rec.Fingerprint != fingerprint:
+				server.Abort(c, terr.ErrIdempotencyKeyReused)
+			default:
+				replay(c, rec)
+			}
+			return
+		}
+
+		w := &recordWriter{ResponseWriter: c.Writer, body: new(bytes.Buffer)}
+		c.Writer = w
+
+		done := false
+		defer func() {
+			// Release the key if the handler panicked, so retries can run.
+			if !done {
+				if err := opts.Store.Release(key); err != nil {
+					log.Error(err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		rec = &Record{
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+			Fingerprint: fingerprint,
+		}
+
+		if serverError(rec) {
+			err = opts.Store.Release(key)
+		} else {
+			err = opts.Store.Complete(key, rec, opts.TTL)
+		}
+		if err != nil {
+			log.Error(err)
+		}
+		done = true
+	}
+}
+
+// storeKey scopes the key to the path and query and the authenticated
+// caller, so clients and resources cannot collide with each other.
+func storeKey(c *gin.Context, idem string) string {
+	caller := ""
+	if p, ok := c.Get(log.PrincipalKey); ok {
+		caller = fmt.Sprint(p)
+	}
+
+	return fmt.Sprintf("%s %s|%s|%s", c.Request.Method, c.Request.URL.RequestURI(), caller, idem)
+}
+
+func replay(c *gin.Context, rec *Record) {
+	if rec.ContentType != "" {
+		c.Header("Content-Type", rec.ContentType)
+	}
+	c.Header("Request-Id", c.GetHeader("Request-Id"))
+	c.Header(ReplayedHeader, "true")
+	c.Status(rec.Status)
+	c.Writer.Write(rec.Body)
+	c.Abort()
+}
+
+// serverError reports whether the response is a 5xx or an envelope with a
+// server error code (1xxxx), which are worth retrying.
+func serverError(rec *Record) bool {
+	if rec.Status >= 500 {
+		return true
+	}
+
+	r := struct {
+		ErrorCode int `json:"errorCode"`
+	}{}
+	if err := json.Unmarshal(rec.Body, &r); err != nil {
+		return false
+	}
+
+	return r.ErrorCode/10000 == 1
+}
+
+type recordWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
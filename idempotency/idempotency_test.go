@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/server"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	calls := 0
+	block := make(chan struct{})
+	started := make(chan struct{})
+	store := NewLocal()
+	defer store.Close()
+
+	r := gin.New()
+	r.POST("/orders", New(Options{Store: store}), func(c *gin.Context) {
+		calls++
+		if c.Query("slow") != "" {
+			close(started)
+			<-block
+		}
+		if c.Query("fail") != "" {
+			server.Fail(c, terr.ErrServer)
+			return
+		}
+		server.OK(c, calls)
+	})
+
+	post := func(url, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set(Header, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("/orders", "a", "{}")
+	again := post("/orders", "a", "{}")
+	if calls != 1 || again.Body.String() != first.Body.String() || again.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("replay: calls %d, %q vs %q", calls, again.Body.String(), first.Body.String())
+	}
+
+	if w := post("/orders", "a", `{"other":1}`); !strings.Contains(w.Body.String(), "20006") {
+		t.Errorf("reused key: %q", w.Body.String())
+	}
+
+	post("/orders?fail=1", "b", "{}")
+	post("/orders?fail=1", "b", "{}")
+	if calls != 3 {
+		t.Errorf("server errors are replayed: calls %d", calls)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		post("/orders?slow=1", "c", "{}")
+		close(done)
+	}()
+	<-started
+	if w := post("/orders?slow=1", "c", "{}"); !strings.Contains(w.Body.String(), "20005") {
+		t.Errorf("in flight: %q", w.Body.String())
+	}
+	close(block)
+	<-done
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || calls != 5 {
+		t.Errorf("without key: calls %d", calls)
+	}
+
+	// The query is part of the key.
+	post("/orders?id=1", "d", "{}")
+	if w := post("/orders?id=2", "d", "{}"); w.Header().Get(ReplayedHeader) != "" || calls != 7 {
+		t.Errorf("other query replayed: calls %d", calls)
+	}
+
+	store.sweep(time.Now().Add(48 * time.Hour))
+	if n := len(store.keys); n != 0 {
+		t.Errorf("%d keys left after sweep", n)
+	}
+}
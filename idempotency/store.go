@@ -0,0 +1,195 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/tinklabs/golibs/cache"
+)
+
+// Store keeps the state of idempotency keys.
+type Store interface {
+	// Begin marks key in flight for lockTTL if it is unknown and returns
+	// true. Otherwise it returns false with the stored record, or a nil
+	// record while the key is in flight.
+	Begin(key string, lockTTL time.Duration) (bool, *Record, error)
+	// Complete stores the record of key for ttl.
+	Complete(key string, rec *Record, ttl time.Duration) error
+	// Release forgets key.
+	Release(key string) error
+}
+
+const inFlight = "inflight"
+
+// Redis keeps keys in redis, shared by every instance of the service.
+type Redis struct {
+	client redis.Cmdable
+}
+
+// NewRedis keeps keys in client, or in cache.Client when client is nil.
+func NewRedis(client redis.Cmdable) *Redis {
+	return &Redis{client: client}
+}
+
+func (s *Redis) cmdable() (redis.Cmdable, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	if cache.Client == nil {
+		return nil, fmt.Errorf("idempotency:cache is not initialized")
+	}
+
+	return cache.Client, nil
+}
+
+func (s *Redis) Begin(key string, lockTTL time.Duration) (bool, *Record, error) {
+	c, err := s.cmdable()
+	if err != nil {
+		return false, nil, err
+	}
+
+	key = "idempotency:" + key
+	ok, err := c.SetNX(key, inFlight, lockTTL).Result()
+	if err != nil {
+		return false, nil, fmt.Errorf("idempotency:%v", err)
+	}
+	if ok {
+		return true, nil, nil
+	}
+
+	v, err := c.Get(key).Result()
+	if err == redis.Nil {
+		// It expired between the two calls; treat it as in flight and let
+		// the client retry.
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("idempotency:%v", err)
+	}
+	if v == inFlight {
+		return false, nil, nil
+	}
+
+	rec := &Record{}
+	if err := json.Unmarshal([]byte(v), rec); err != nil {
+		return false, nil, fmt.Errorf("idempotency:%v", err)
+	}
+
+	return false, rec, nil
+}
+
+func (s *Redis) Complete(key string, rec *Record, ttl time.Duration) error {
+	c, err := s.cmdable()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("idempotency:%v", err)
+	}
+
+	if err := c.Set("idempotency:"+key, b, ttl).Err(); err != nil {
+		return fmt.Errorf("idempotency:%v", err)
+	}
+
+	return nil
+}
+
+func (s *Redis) Release(key string) error {
+	c, err := s.cmdable()
+	if err != nil {
+		return err
+	}
+
+	if err := c.Del("idempotency:" + key).Err(); err != nil {
+		return fmt.Errorf("idempotency:%v", err)
+	}
+
+	return nil
+}
+
+// Local keeps keys in process memory, for tests and single instance
+// services. Expired keys are swept every minute until Close.
+type Local struct {
+	mu   sync.Mutex
+	keys map[string]*localEntry
+
+	once sync.Once
+	stop chan struct{}
+}
+
+type localEntry struct {
+	rec *Record
+	exp time.Time
+}
+
+func NewLocal() *Local {
+	s := &Local{keys: map[string]*localEntry{}, stop: make(chan struct{})}
+	go s.run(time.Minute)
+
+	return s
+}
+
+func (s *Local) run(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// sweep drops the keys expired at now.
+func (s *Local) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, e := range s.keys {
+		if !now.Before(e.exp) {
+			delete(s.keys, k)
+		}
+	}
+}
+
+// Close stops sweeping expired keys.
+func (s *Local) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Local) Begin(key string, lockTTL time.Duration) (bool, *Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.keys[key]; ok && time.Now().Before(e.exp) {
+		return false, e.rec, nil
+	}
+
+	s.keys[key] = &localEntry{exp: time.Now().Add(lockTTL)}
+	return true, nil, nil
+}
+
+func (s *Local) Complete(key string, rec *Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key] = &localEntry{rec: rec, exp: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *Local) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.keys, key)
+	return nil
+}
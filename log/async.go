@@ -0,0 +1,217 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Overflow is what an async logger does when its queue is full.
+type Overflow int
+
+const (
+	// Block waits for room in the queue, slowing the caller down.
+	Block Overflow = iota
+	// DropLowest drops the least severe entry, queued or new, so errors
+	// get through a flood of debug lines.
+	DropLowest
+	// Drop drops the new entry.
+	Drop
+)
+
+// ParseOverflow parses block, drop-lowest or drop.
+func ParseOverflow(s string) (Overflow, error) {
+	switch s {
+	case "block":
+		return Block, nil
+	case "drop-lowest":
+		return DropLowest, nil
+	case "drop":
+		return Drop, nil
+	}
+
+	return Block, fmt.Errorf("unknown overflow %q", s)
+}
+
+const (
+	defaultQueueSize = 4096
+	defaultBatchSize = 128
+)
+
+type queued struct {
+	level logrus.Level
+	b     []byte
+}
+
+// asyncWriter queues the entries written by logrus and writes them to out
+// in batches from a goroutine.
+type asyncWriter struct {
+	out       io.Writer
+	size      int
+	batchSize int
+	overflow  Overflow
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	queue   []queued
+	writing bool
+	closed  bool
+	// level is the level of the entry being written, set by
+	// levelFormatter. logrus formats and writes under the same lock.
+	level   logrus.Level
+	dropped map[logrus.Level]uint64
+	done    chan struct{}
+}
+
+func newAsyncWriter(out io.Writer, size, batchSize int, overflow Overflow) *asyncWriter {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	w := &asyncWriter{
+		out:       out,
+		size:      size,
+		batchSize: batchSize,
+		overflow:  overflow,
+		level:     logrus.InfoLevel,
+		dropped:   map[logrus.Level]uint64{},
+		done:      make(chan struct{}),
+	}
+	w.changed = sync.NewCond(&w.mu)
+
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	// logrus reuses its buffer.
+	e := queued{level: w.level, b: append([]byte(nil), p...)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return w.out.Write(p)
+	}
+
+	for len(w.queue) >= w.size {
+		switch w.overflow {
+		case Drop:
+			w.dropped[e.level]++
+			return len(p), nil
+		case DropLowest:
+			// Higher logrus levels are less severe.
+			lowest := 0
+			for i, q := range w.queue {
+				if q.level > w.queue[lowest].level {
+					lowest = i
+				}
+			}
+			if w.queue[lowest].level < e.level {
+				w.dropped[e.level]++
+				return len(p), nil
+			}
+			w.dropped[w.queue[lowest].level]++
+			w.queue = append(w.queue[:lowest], w.queue[lowest+1:]...)
+		default:
+			w.changed.Wait()
+			if w.closed {
+				return w.out.Write(p)
+			}
+		}
+	}
+
+	w.queue = append(w.queue, e)
+	w.changed.Broadcast()
+	return len(p), nil
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	buf := new(bytes.Buffer)
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.changed.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+
+		n := len(w.queue)
+		if n > w.batchSize {
+			n = w.batchSize
+		}
+		buf.Reset()
+		for _, q := range w.queue[:n] {
+			buf.Write(q.b)
+		}
+		w.queue = append(w.queue[:0], w.queue[n:]...)
+		w.writing = true
+		w.changed.Broadcast()
+		w.mu.Unlock()
+
+		if _, err := w.out.Write(buf.Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write to log, %v\n", err)
+		}
+
+		w.mu.Lock()
+		w.writing = false
+		w.changed.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// Flush waits until the queued entries are written.
+func (w *asyncWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for (len(w.queue) > 0 || w.writing) && !w.closed {
+		w.changed.Wait()
+	}
+}
+
+// Close writes the queued entries and stops the goroutine. Later entries
+// are written synchronously.
+func (w *asyncWriter) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.changed.Broadcast()
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+func (w *asyncWriter) Dropped() map[string]uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m := make(map[string]uint64, len(w.dropped))
+	for level, n := range w.dropped {
+		m[level.String()] = n
+	}
+
+	return m
+}
+
+// levelFormatter tells the async writer the level of the entry it is about
+// to write.
+type levelFormatter struct {
+	logrus.Formatter
+	w *asyncWriter
+}
+
+func (f levelFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	f.w.level = e.Level
+	return f.Formatter.Format(e)
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// gatedWriter blocks writes until open is closed.
+type gatedWriter struct {
+	open chan struct{}
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.open
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestAsync(t *testing.T) {
+	for _, overflow := range []Overflow{Drop, DropLowest} {
+		out := &gatedWriter{open: make(chan struct{})}
+		l := &Log{logger: newLogrus(logrus.DebugLevel, out)}
+		l.setAsync(Options{Async: true, QueueSize: 2, BatchSize: 1, Overflow: overflow})
+
+		// The first entry is taken by the writer, which blocks; two more
+		// fill the queue.
+		l.Debug("d1")
+		l.async.mu.Lock()
+		for len(l.async.queue) > 0 || !l.async.writing {
+			l.async.changed.Wait()
+		}
+		l.async.mu.Unlock()
+		l.Debug("d2")
+		l.Debug("d3")
+		l.Error("e1")
+
+		close(out.open)
+		l.Flush()
+		got := out.buf.String()
+
+		switch overflow {
+		case Drop:
+			if strings.Contains(got, "e1") || l.Dropped()["error"] != 1 {
+				t.Errorf("drop: %s %v", got, l.Dropped())
+			}
+		case DropLowest:
+			if !strings.Contains(got, "e1") || strings.Contains(got, "d2") || l.Dropped()["debug"] != 1 {
+				t.Errorf("drop lowest: %s %v", got, l.Dropped())
+			}
+		}
+		l.Close()
+	}
+}
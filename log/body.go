@@ -0,0 +1,215 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecretKeys are the keys whose values are secret: a key equal to one of
+// them, ignoring case, '_' and '-', is masked in logged bodies and in the
+// dumps of the admin server, e.g. access_token, apiKey or hmac_keys. Other
+// keys, such as roomKey or phone, are left to Options.RedactKeys.
+var SecretKeys = []string{
+	"password", "passwd", "pwd", "secret", "clientsecret", "apisecret",
+	"token", "accesstoken", "refreshtoken", "idtoken", "consulaccesstoken",
+	"apikey", "privatekey", "signingkey", "hmackey", "hmackeys",
+	"credential", "credentials", "authorization",
+}
+
+// defaultMaxBodySize is the size logged bodies are truncated to when
+// Options.MaxBodySize is zero.
+const defaultMaxBodySize = 4096
+
+const redacted = "******"
+
+// skipBodyKey is the gin context key set by SkipBody.
+const skipBodyKey = "log.skipBody"
+
+// SkipBody returns a middleware keeping the bodies of a route out of the
+// access log, e.g. for routes carrying documents or personal data:
+//
+//	server.Register("v1", "POST", "/passport", Upload, server.Middleware(log.SkipBody()))
+func SkipBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(skipBodyKey, true)
+	}
+}
+
+// normalizeKey makes access_token, access-token and accessToken equal.
+func normalizeKey(k string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(k))
+}
+
+// IsSecret reports whether key is one of SecretKeys.
+func IsSecret(key string) bool {
+	key = normalizeKey(key)
+	for _, k := range SecretKeys {
+		if key == normalizeKey(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redactSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[normalizeKey(k)] = true
+	}
+
+	return set
+}
+
+// bodyLogWriter keeps a copy of the response body, unless it is binary.
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+	size int
+	// skip is decided on the first write, once the content type is known.
+	skip    bool
+	decided bool
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *bodyLogWriter) capture(b []byte) {
+	if !w.decided {
+		w.decided = true
+		ct := w.Header().Get("Content-Type")
+		w.skip = ct != "" && !textual(ct)
+	}
+
+	w.size += len(b)
+	if !w.skip {
+		w.body.Write(b)
+	}
+}
+
+// textual reports whether bodies of content type ct are worth logging.
+func textual(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		mt == "application/json", strings.HasSuffix(mt, "+json"),
+		mt == "application/xml", strings.HasSuffix(mt, "+xml"),
+		mt == "application/x-www-form-urlencoded":
+		return true
+	}
+
+	return false
+}
+
+// skipped stands for a body that is not logged. size is negative when it
+// is unknown.
+func skipped(ct string, size int) string {
+	if ct == "" {
+		ct = "unknown"
+	}
+	if size < 0 {
+		return fmt.Sprintf("[%s]", ct)
+	}
+
+	return fmt.Sprintf("[%s, %d bytes]", ct, size)
+}
+
+// redacts reports whether the values of key are masked in logged bodies.
+func (l *Log) redacts(key string) bool {
+	return IsSecret(key) || l.redact[normalizeKey(key)]
+}
+
+// body formats a logged body: JSON and form values of redacted keys are
+// masked, then the body is truncated to the maximum size.
+func (l *Log) body(ct string, b []byte) string {
+	mt, _, _ := mime.ParseMediaType(ct)
+	trimmed := bytes.TrimSpace(b)
+	isJSON := mt == "application/json" || strings.HasSuffix(mt, "+json") ||
+		(mt == "" && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '['))
+
+	s := string(b)
+	switch {
+	case isJSON:
+		s = redactJSON(b, l.redacts)
+	case mt == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(s); err == nil {
+			for k := range values {
+				if l.redacts(k) {
+					values[k] = []string{redacted}
+				}
+			}
+			s = values.Encode()
+		}
+	}
+
+	max := l.maxBody
+	if max == 0 {
+		max = defaultMaxBodySize
+	}
+	if max > 0 && len(s) > max {
+		cut := max
+		// Cut on a rune boundary.
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = fmt.Sprintf("%s...(truncated, %d bytes)", s[:cut], len(s))
+	}
+
+	return s
+}
+
+// redactJSON returns b compacted with the values of redacted keys masked at
+// any depth. Invalid JSON is returned as is.
+func redactJSON(b []byte, redacts func(string) bool) string {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return string(b)
+	}
+
+	out, err := json.Marshal(redactValue(v, redacts))
+	if err != nil {
+		return string(b)
+	}
+
+	return string(out)
+}
+
+func redactValue(v interface{}, redacts func(string) bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if redacts(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redactValue(e, redacts)
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = redactValue(e, redacts)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,227 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// TraceHeader carries the trace ID of a request across services. A W3C
+// traceparent header is honoured when it is missing.
+const TraceHeader = "X-Trace-Id"
+
+// scopeKey is the gin and request context key of the request scope.
+const scopeKey = "log.scope"
+
+type scopeCtxKey struct{}
+
+// scope holds the fields of a request, shared by every line logged for it
+// and its access log line.
+type scope struct {
+	l *Log
+	c *gin.Context
+
+	mu     sync.Mutex
+	fields Fields
+}
+
+// newScope starts the scope of the request of c, logging to l.
+func newScope(l *Log, c *gin.Context) *scope {
+	traceID := c.GetHeader(TraceHeader)
+	if !validTraceID(traceID) {
+		traceID = fromTraceparent(c.GetHeader("traceparent"))
+	}
+	if traceID == "" {
+		traceID = newTraceID()
+	}
+	c.Header(TraceHeader, traceID)
+
+	sc := &scope{l: l, c: c, fields: Fields{
+		"request-id": c.GetHeader("Request-Id"),
+		"trace-id":   traceID,
+		"clientIP":   c.ClientIP(),
+	}}
+
+	c.Set(scopeKey, sc)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), scopeCtxKey{}, sc))
+
+	return sc
+}
+
+// fromTraceparent returns the trace ID of a W3C traceparent header,
+// version-traceid-parentid-flags.
+func fromTraceparent(tp string) string {
+	parts := strings.Split(tp, "-")
+	if len(parts) != 4 || !validTraceID(parts[1]) {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// validTraceID reports whether id is 32 hex characters, as generated by
+// newTraceID. Other IDs sent by clients are replaced rather than logged.
+func validTraceID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *scope) add(f Fields) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, v := range f {
+		s.fields[k] = v
+	}
+}
+
+// snapshot returns a copy of the fields, with the principal authenticated
+// so far.
+func (s *scope) snapshot() Fields {
+	s.mu.Lock()
+	f := make(Fields, len(s.fields)+1)
+	for k, v := range s.fields {
+		f[k] = v
+	}
+	s.mu.Unlock()
+
+	if p, ok := s.c.Get(PrincipalKey); ok {
+		f["principal"] = fmt.Sprint(p)
+	}
+
+	return f
+}
+
+// Entry logs with the fields of a request: request-id, trace-id, clientIP,
+// route and principal, plus those added with With.
+type Entry struct {
+	l      *Log
+	sc     *scope
+	fields Fields
+}
+
+// FromGin returns the entry of the request of c. Outside the access log
+// middleware it logs to the default logger without request fields.
+func FromGin(c *gin.Context) *Entry {
+	if v, ok := c.Get(scopeKey); ok {
+		sc := v.(*scope)
+		return &Entry{l: sc.l, sc: sc}
+	}
+
+	return FromContext(c.Request.Context())
+}
+
+// FromContext returns the entry of the request whose context is ctx, as
+// passed to typed handlers. Other contexts log to the default logger
+// without request fields.
+func FromContext(ctx context.Context) *Entry {
+	if sc, ok := ctx.Value(scopeCtxKey{}).(*scope); ok {
+		return &Entry{l: sc.l, sc: sc}
+	}
+
+	return &Entry{l: std}
+}
+
+// With adds fields to the request, so they appear on every later line of
+// it, including the access log line.
+func (e *Entry) With(f Fields) *Entry {
+	if e.sc != nil {
+		e.sc.add(f)
+		return e
+	}
+
+	fields := e.Fields()
+	for k, v := range f {
+		fields[k] = v
+	}
+
+	return &Entry{l: e.l, fields: fields}
+}
+
+// Fields returns a copy of the fields of e.
+func (e *Entry) Fields() Fields {
+	if e.sc != nil {
+		return e.sc.snapshot()
+	}
+
+	f := make(Fields, len(e.fields))
+	for k, v := range e.fields {
+		f[k] = v
+	}
+
+	return f
+}
+
+func (e *Entry) merge(f Fields) Fields {
+	fields := e.Fields()
+	for k, v := range f {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// Debug logs a message at level Debug with the request fields.
+func (e *Entry) Debug(args ...interface{}) {
+	e.l.log(logrus.DebugLevel, e.Fields(), args...)
+}
+
+// DebugWithFields logs a message with fields at level Debug.
+func (e *Entry) DebugWithFields(msg interface{}, f Fields) {
+	e.l.log(logrus.DebugLevel, e.merge(f), msg)
+}
+
+// Info logs a message at level Info with the request fields.
+func (e *Entry) Info(args ...interface{}) {
+	e.l.log(logrus.InfoLevel, e.Fields(), args...)
+}
+
+// InfoWithFields logs a message with fields at level Info.
+func (e *Entry) InfoWithFields(msg interface{}, f Fields) {
+	e.l.log(logrus.InfoLevel, e.merge(f), msg)
+}
+
+// Warn logs a message at level Warn with the request fields.
+func (e *Entry) Warn(args ...interface{}) {
+	e.l.log(logrus.WarnLevel, e.Fields(), args...)
+}
+
+// WarnWithFields logs a message with fields at level Warn.
+func (e *Entry) WarnWithFields(msg interface{}, f Fields) {
+	e.l.log(logrus.WarnLevel, e.merge(f), msg)
+}
+
+// Error logs a message at level Error with the request fields.
+func (e *Entry) Error(args ...interface{}) {
+	e.l.log(logrus.ErrorLevel, e.Fields(), args...)
+}
+
+// ErrorWithFields logs a message with fields at level Error.
+func (e *Entry) ErrorWithFields(msg interface{}, f Fields) {
+	e.l.log(logrus.ErrorLevel, e.merge(f), msg)
+}
+
+// Fatal logs a message at level Fatal with the request fields.
+func (e *Entry) Fatal(args ...interface{}) {
+	e.l.log(logrus.FatalLevel, e.Fields(), args...)
+}
+
+// Panic logs a message at level Panic with the request fields.
+func (e *Entry) Panic(args ...interface{}) {
+	e.l.log(logrus.PanicLevel, e.Fields(), args...)
+}
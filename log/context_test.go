@@ -0,0 +1,84 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFromGin(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	out := new(bytes.Buffer)
+	l := &Log{logger: newLogrus(logrus.InfoLevel, out)}
+
+	r := gin.New()
+	r.Use(l.Middleware())
+	r.GET("/bookings", func(c *gin.Context) {
+		c.Set(PrincipalKey, "jwt:guest")
+		FromGin(c).With(Fields{"booking": "B1"})
+		FromContext(c.Request.Context()).Info("found")
+		c.String(200, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/bookings", nil)
+	req.Header.Set("Request-Id", "r1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+
+	for _, line := range lines {
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(line), &m)
+		for k, want := range map[string]string{
+			"request-id": "r1",
+			"trace-id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+			"principal":  "jwt:guest",
+			"booking":    "B1",
+		} {
+			if m[k] != want {
+				t.Errorf("%s = %v in %s", k, m[k], line)
+			}
+		}
+	}
+
+	if w.Header().Get(TraceHeader) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace header = %q", w.Header().Get(TraceHeader))
+	}
+}
+
+func TestTraceHeader(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	l := &Log{logger: newLogrus(logrus.InfoLevel, new(bytes.Buffer))}
+	r := gin.New()
+	r.Use(l.Middleware())
+	r.GET("/", func(c *gin.Context) { c.String(200, "ok") })
+
+	for header, kept := range map[string]bool{
+		"0af7651916cd43dd8448eb211c80319c": true,
+		"0af7651916cd43dd8448eb211c80319":  false,
+		"0af7651916cd43dd8448eb211c80319z": false,
+		"a\nfake=log line":                 false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(TraceHeader, header)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		got := w.Header().Get(TraceHeader)
+		if (got == header) != kept || !validTraceID(got) {
+			t.Errorf("trace header %q = %q", header, got)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxDedupKeys bounds the messages tracked at once. Messages beyond it,
+// typically ones embedding IDs, are logged without deduplication.
+const maxDedupKeys = 10000
+
+type dedupKey struct {
+	level  logrus.Level
+	logger string
+	route  string
+	msg    string
+}
+
+// dedupWindow counts a message since start.
+type dedupWindow struct {
+	start      time.Time
+	n          int
+	suppressed int
+	// lastTraceID is the trace-id of the last suppressed entry.
+	lastTraceID string
+}
+
+// dedup lets n identical messages per interval through, or the limit of
+// their named logger in loggers. The others are counted and logged as one
+// line with a suppressed field once the interval is over.
+type dedup struct {
+	logger   *logrus.Logger
+	n        int
+	loggers  map[string]int
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[dedupKey]*dedupWindow
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newDedup(logger *logrus.Logger, n int, loggers map[string]int, interval time.Duration) *dedup {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	d := &dedup{
+		logger:   logger,
+		n:        n,
+		loggers:  loggers,
+		interval: interval,
+		seen:     map[dedupKey]*dedupWindow{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+
+	return d
+}
+
+// allow reports whether an entry may be written. Entries without a
+// message, such as access log lines, and fatal and panic entries always
+// are.
+//
+// Entries are the same when their level, logger, route and message are.
+// Other fields, such as request-id and trace-id, are left out, so an error
+// logged by many requests is written n times per interval; its summary
+// carries the trace-id of the last suppressed entry as last-trace-id.
+func (d *dedup) allow(level logrus.Level, f Fields, args []interface{}) bool {
+	if level <= logrus.FatalLevel {
+		return true
+	}
+
+	msg := fmt.Sprint(args...)
+	if msg == "" {
+		return true
+	}
+
+	k := dedupKey{level: level, msg: msg}
+	k.logger, _ = f["logger"].(string)
+	n, ok := d.loggers[k.logger]
+	if !ok || k.logger == "" {
+		n = d.n
+	}
+	if n <= 0 {
+		return true
+	}
+	k.route, _ = f["route"].(string)
+	now := time.Now()
+
+	d.mu.Lock()
+	w := d.seen[k]
+	var ended *dedupWindow
+	if w != nil && now.Sub(w.start) >= d.interval {
+		ended, w = w, nil
+		delete(d.seen, k)
+	}
+	if w == nil {
+		if len(d.seen) >= maxDedupKeys {
+			d.mu.Unlock()
+			d.summarize(k, ended)
+			return true
+		}
+		w = &dedupWindow{start: now}
+		d.seen[k] = w
+	}
+
+	w.n++
+	allow := w.n <= n
+	if !allow {
+		w.suppressed++
+		w.lastTraceID, _ = f["trace-id"].(string)
+	}
+	d.mu.Unlock()
+
+	// The summary of the last interval comes before the new message.
+	d.summarize(k, ended)
+	return allow
+}
+
+func (d *dedup) summarize(k dedupKey, w *dedupWindow) {
+	if w == nil || w.suppressed == 0 {
+		return
+	}
+
+	f := logrus.Fields{"suppressed": w.suppressed}
+	if k.logger != "" {
+		f["logger"] = k.logger
+	}
+	if k.route != "" {
+		f["route"] = k.route
+	}
+	if w.lastTraceID != "" {
+		f["last-trace-id"] = w.lastTraceID
+	}
+	d.logger.WithFields(f).Log(k.level, k.msg)
+}
+
+func (d *dedup) run() {
+	defer close(d.done)
+
+	// Sweeping more often than the interval logs each summary at most a
+	// quarter of an interval after its window ends.
+	ticker := time.NewTicker(d.interval / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			d.sweep(now, false)
+		}
+	}
+}
+
+// sweep logs the summaries of the intervals over at now, or of all of them.
+func (d *dedup) sweep(now time.Time, all bool) {
+	ended := map[dedupKey]*dedupWindow{}
+
+	d.mu.Lock()
+	for k, w := range d.seen {
+		if all || now.Sub(w.start) >= d.interval {
+			ended[k] = w
+			delete(d.seen, k)
+		}
+	}
+	d.mu.Unlock()
+
+	for k, w := range ended {
+		d.summarize(k, w)
+	}
+}
+
+// flush logs the summaries of the current intervals.
+func (d *dedup) flush() {
+	d.sweep(time.Now(), true)
+}
+
+func (d *dedup) close() {
+	d.once.Do(func() { close(d.stop) })
+	<-d.done
+	d.flush()
+}
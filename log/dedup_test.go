@@ -0,0 +1,131 @@
+package log
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDedup(t *testing.T) {
+	out := new(bytes.Buffer)
+	l := &Log{logger: newLogrus(logrus.InfoLevel, out), noCaller: true}
+	l.dedup = newDedup(l.logger, 2, nil, time.Hour)
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		l.Error("consul is down")
+	}
+	l.Warn("consul is down")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines = %q", lines)
+	}
+
+	out.Reset()
+	l.Flush()
+	if s := out.String(); strings.Count(s, "\n") != 1 || !strings.Contains(s, `"suppressed":3`) || !strings.Contains(s, "consul is down") {
+		t.Errorf("summary = %s", s)
+	}
+
+	// A new interval starts after the summary.
+	out.Reset()
+	l.Error("consul is down")
+	if out.Len() == 0 {
+		t.Error("message dropped after flush")
+	}
+
+	// Requests on a route share a summary, which points at the last one.
+	out.Reset()
+	for _, trace := range []string{"t1", "t2", "t3", "t4"} {
+		l.WarnWithFields("room is full", Fields{"route": "book", "trace-id": trace})
+	}
+	l.WarnWithFields("room is full", Fields{"route": "cancel", "trace-id": "t5"})
+	if n := strings.Count(out.String(), "\n"); n != 3 {
+		t.Errorf("lines = %d in %s", n, out)
+	}
+	out.Reset()
+	l.Flush()
+	if s := out.String(); !strings.Contains(s, `"suppressed":2`) || !strings.Contains(s, `"route":"book"`) || !strings.Contains(s, `"last-trace-id":"t4"`) {
+		t.Errorf("summary = %s", s)
+	}
+}
+
+func TestDedupSweep(t *testing.T) {
+	out := &gatedWriter{open: make(chan struct{})}
+	close(out.open)
+	l := &Log{logger: newLogrus(logrus.InfoLevel, out), noCaller: true}
+	l.dedup = newDedup(l.logger, 1, nil, 40*time.Millisecond)
+	defer l.Close()
+
+	l.Error("consul is down")
+	l.Error("consul is down")
+
+	// The summary comes within a quarter of an interval of its end.
+	time.Sleep(100 * time.Millisecond)
+	l.dedup.mu.Lock()
+	n := len(l.dedup.seen)
+	l.dedup.mu.Unlock()
+	out.mu.Lock()
+	s := out.buf.String()
+	out.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d windows left after the interval", n)
+	}
+	if lines := strings.Split(strings.TrimSpace(s), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"suppressed":1`) || !strings.Contains(lines[1], "consul is down") {
+		t.Errorf("out = %s", s)
+	}
+}
+
+func TestDedupLoggers(t *testing.T) {
+	loggers, err := parseDedupLoggers("consul=1, db=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseDedupLoggers("consul"); err == nil {
+		t.Error("parsed consul")
+	}
+
+	l := &Log{logger: newLogrus(logrus.InfoLevel, new(bytes.Buffer)), noCaller: true}
+	l.dedup = newDedup(l.logger, 3, loggers, time.Hour)
+	defer l.Close()
+
+	allowed := map[string]int{}
+	for _, name := range []string{"consul", "db", "redis"} {
+		for i := 0; i < 5; i++ {
+			if l.dedup.allow(logrus.ErrorLevel, Fields{"logger": name}, []interface{}{"down"}) {
+				allowed[name]++
+			}
+		}
+	}
+	if allowed["consul"] != 1 || allowed["db"] != 5 || allowed["redis"] != 3 {
+		t.Errorf("allowed = %v", allowed)
+	}
+}
+
+func TestAccessSample(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	out := new(bytes.Buffer)
+	l := &Log{logger: newLogrus(logrus.InfoLevel, out), accessSample: 1e-9}
+
+	r := gin.New()
+	r.Use(l.Middleware())
+	r.GET("/ok", func(c *gin.Context) { c.JSON(200, gin.H{"errorCode": 0}) })
+	r.GET("/fail", func(c *gin.Context) { c.JSON(200, gin.H{"errorCode": 20001}) })
+	r.GET("/boom", func(c *gin.Context) { c.String(500, "boom") })
+
+	for _, path := range []string{"/ok", "/ok", "/ok", "/fail", "/boom"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	s := out.String()
+	if strings.Count(s, "\n") != 2 || strings.Contains(s, `"path":"/ok"`) {
+		t.Errorf("out = %s", s)
+	}
+}
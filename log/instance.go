@@ -0,0 +1,490 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/tinklabs/golibs/cmd"
+)
+
+// PrincipalKey is the gin context key of the authenticated principal,
+// logged by the access log middleware.
+const PrincipalKey = "principal"
+
+// std is the logger behind the package-level functions. It writes JSON to
+// stdout until Init replaces it, so logging before Init does not panic.
+var std = &Log{logger: newLogrus(logrus.InfoLevel, os.Stdout)}
+
+// Fields wraps logrus.Fields, which is a map[string]interface{}
+type Fields logrus.Fields
+
+// Options configures a Log created by New.
+type Options struct {
+	// Name is the base name of the log file, written as <Name>.log in Dir
+	// when Debug is off.
+	Name string
+	// Dir is the directory of the log files, the working directory by
+	// default.
+	Dir string
+	// MaxSize rotates the file before it grows over MaxSize bytes, and
+	// RotateEvery when the interval changes, e.g. at midnight UTC for 24h.
+	// Rotated files are named <Name>-<time>.log. Zero values disable them.
+	MaxSize     int64
+	RotateEvery time.Duration
+	// MaxBackups and MaxAge remove rotated files beyond the newest
+	// MaxBackups or older than MaxAge. Zero values keep them all.
+	MaxBackups int
+	MaxAge     time.Duration
+	// Compress gzips rotated files.
+	Compress bool
+	// Debug logs at Debug level to stdout only.
+	Debug bool
+	// RedactKeys are JSON and form keys whose values the access log masks
+	// at any depth, besides SecretKeys, e.g. phone. Keys match ignoring
+	// case, '_' and '-'.
+	RedactKeys []string
+	// MaxBodySize truncates the bodies in the access log, 4096 bytes by
+	// default. Negative values log bodies whole.
+	MaxBodySize int
+	// DisableCaller leaves out the file and line of the call, which cost a
+	// runtime.Caller per line.
+	DisableCaller bool
+	// AccessLevel is the level of the access log lines, info by default.
+	// Set it to debug to only get them when debugging.
+	AccessLevel string
+	// Async writes entries from a goroutine, so a slow disk does not slow
+	// requests down. Up to QueueSize entries (4096 by default) wait in
+	// memory and are written BatchSize (128) at a time. Overflow decides
+	// what happens to entries when the queue is full. Flush or Close
+	// before exiting, as server.Stop does.
+	Async     bool
+	QueueSize int
+	BatchSize int
+	Overflow  Overflow
+	// Dedup lets at most Dedup identical messages of a level through per
+	// DedupInterval (1m by default). The others are counted and logged once
+	// the interval is over, as a single line with a suppressed field. Lines
+	// of different requests with the same message and route count as
+	// identical. Zero disables it. DedupLoggers sets the limit of named
+	// loggers, e.g. {"consul": 1}, zero leaving one out.
+	Dedup         int
+	DedupLoggers  map[string]int
+	DedupInterval time.Duration
+	// AccessSample keeps this fraction of the access log lines of
+	// successful requests, e.g. 0.1 for one in ten, when AccessLevel is
+	// info. Requests answered with a 4xx or 5xx status or an errorCode are
+	// always logged. Zero logs every request.
+	AccessSample float64
+}
+
+// Log is a logger instance. The package-level functions log through the
+// default instance installed by Init.
+type Log struct {
+	logger *logrus.Logger
+	file   *rotatingFile
+	async  *asyncWriter
+	sinks  []*sinkHook
+	// redact and maxBody are Options.RedactKeys and MaxBodySize, 0 for the
+	// default size.
+	redact  map[string]bool
+	maxBody int
+	// noCaller and accessLevel are Options.DisableCaller and AccessLevel.
+	noCaller    bool
+	accessLevel logrus.Level
+	// dedup and accessSample are Options.Dedup and AccessSample.
+	dedup        *dedup
+	accessSample float64
+	// level is the lowest level written plus one, read atomically. It is
+	// set once named loggers raise the level of logger above it; zero
+	// means the level of logger.
+	level int32
+}
+
+// New creates a logger from opts.
+func New(opts Options) (*Log, error) {
+	l := &Log{
+		maxBody:      opts.MaxBodySize,
+		noCaller:     opts.DisableCaller,
+		accessLevel:  logrus.InfoLevel,
+		accessSample: opts.AccessSample,
+	}
+	if opts.RedactKeys != nil {
+		l.redact = redactSet(opts.RedactKeys)
+	}
+
+	if opts.AccessLevel != "" {
+		level, err := logrus.ParseLevel(opts.AccessLevel)
+		if err != nil {
+			return nil, fmt.Errorf("access level:%v", err)
+		}
+		l.accessLevel = level
+	}
+
+	if opts.Debug {
+		l.logger = newLogrus(logrus.DebugLevel, os.Stdout)
+		l.setAsync(opts)
+		l.setDedup(opts)
+		return l, nil
+	}
+
+	f, err := openRotating(rotateOptions{
+		dir:        opts.Dir,
+		name:       opts.Name,
+		maxSize:    opts.MaxSize,
+		every:      opts.RotateEvery,
+		maxBackups: opts.MaxBackups,
+		maxAge:     opts.MaxAge,
+		compress:   opts.Compress,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.logger = newLogrus(logrus.InfoLevel, io.MultiWriter(os.Stdout, f))
+	l.file = f
+	l.setAsync(opts)
+	l.setDedup(opts)
+	return l, nil
+}
+
+func (l *Log) setAsync(opts Options) {
+	if !opts.Async {
+		return
+	}
+
+	l.async = newAsyncWriter(l.logger.Out, opts.QueueSize, opts.BatchSize, opts.Overflow)
+	l.logger.SetOutput(l.async)
+	l.logger.Formatter = levelFormatter{Formatter: l.logger.Formatter, w: l.async}
+}
+
+func (l *Log) setDedup(opts Options) {
+	if opts.Dedup > 0 || len(opts.DedupLoggers) > 0 {
+		l.dedup = newDedup(l.logger, opts.Dedup, opts.DedupLoggers, opts.DedupInterval)
+	}
+}
+
+func newLogrus(level logrus.Level, out io.Writer) *logrus.Logger {
+	logger := logrus.New()
+	// Log as JSON instead of the default ASCII formatter.
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(level)
+	logger.SetOutput(out)
+
+	return logger
+}
+
+// Init creates the default logger from the flags read by cmd.Init.
+func Init() {
+	cf := cmd.GetCmdFlag()
+	if cf == nil {
+		panic("init log:cmd is not initialized")
+	}
+
+	opts := Options{Name: cf.ServerName, Debug: cf.Debug}
+
+	// LOG_REDACT_KEYS holds comma separated RedactKeys.
+	if keys := cmd.GetEnvWithDefault("LOG_REDACT_KEYS", ""); keys != "" {
+		opts.RedactKeys = strings.Split(keys, ",")
+	}
+
+	opts.MaxBodySize = envInt("LOG_MAX_BODY_SIZE", 0)
+
+	opts.Dir = cmd.GetEnvWithDefault("LOG_DIR", "")
+	opts.MaxSize = int64(envInt("LOG_MAX_SIZE_MB", 0)) << 20
+	opts.RotateEvery = envDuration("LOG_ROTATE_EVERY")
+	opts.MaxBackups = envInt("LOG_MAX_BACKUPS", 0)
+	opts.MaxAge = envDuration("LOG_MAX_AGE")
+	opts.Compress = cmd.GetEnvWithDefault("LOG_COMPRESS", "false") == "true"
+
+	opts.DisableCaller = cmd.GetEnvWithDefault("LOG_CALLER", "true") == "false"
+	opts.AccessLevel = cmd.GetEnvWithDefault("LOG_ACCESS_LEVEL", "info")
+
+	opts.Async = cmd.GetEnvWithDefault("LOG_ASYNC", "false") == "true"
+	opts.QueueSize = envInt("LOG_QUEUE_SIZE", 0)
+	opts.BatchSize = envInt("LOG_BATCH_SIZE", 0)
+	overflow, err := ParseOverflow(cmd.GetEnvWithDefault("LOG_OVERFLOW", "block"))
+	if err != nil {
+		panic(fmt.Sprintf("init log:%v", err))
+	}
+	opts.Overflow = overflow
+
+	// By default a message is written 10 times a minute, and once for the
+	// consul logger, whose watches repeat their errors on every retry.
+	// LOG_DEDUP_LOGGERS holds comma separated name=limit pairs.
+	opts.Dedup = envInt("LOG_DEDUP", 10)
+	if opts.DedupLoggers, err = parseDedupLoggers(cmd.GetEnvWithDefault("LOG_DEDUP_LOGGERS", "consul=1")); err != nil {
+		panic(fmt.Sprintf("init log:LOG_DEDUP_LOGGERS:%v", err))
+	}
+	opts.DedupInterval = envDuration("LOG_DEDUP_INTERVAL")
+	if v := cmd.GetEnvWithDefault("LOG_ACCESS_SAMPLE", ""); v != "" {
+		if opts.AccessSample, err = strconv.ParseFloat(v, 64); err != nil {
+			panic(fmt.Sprintf("init log:LOG_ACCESS_SAMPLE:%v", err))
+		}
+	}
+
+	l, err := New(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// LOG_SINKS lists comma separated sink URLs, see ParseSink.
+	if sinks := cmd.GetEnvWithDefault("LOG_SINKS", ""); sinks != "" {
+		for _, u := range strings.Split(sinks, ",") {
+			sink, sinkOpts, err := ParseSink(strings.TrimSpace(u))
+			if err != nil {
+				panic(fmt.Sprintf("init log:%v", err))
+			}
+			if err := l.AddSink(sink, sinkOpts); err != nil {
+				panic(fmt.Sprintf("init log:%v", err))
+			}
+		}
+	}
+
+	SetDefault(l)
+
+	// LOG_LEVELS sets the levels of named loggers, see SetLevels.
+	if levels := cmd.GetEnvWithDefault("LOG_LEVELS", ""); levels != "" {
+		if err := SetLevels(levels); err != nil {
+			panic(fmt.Sprintf("init log:%v", err))
+		}
+	}
+
+	hupOnce.Do(func() { go reopenOnHUP() })
+}
+
+var hupOnce sync.Once
+
+// parseDedupLoggers parses name=limit pairs separated by commas, e.g.
+// "consul=1,db=5".
+func parseDedupLoggers(s string) (map[string]int, error) {
+	m := map[string]int{}
+	for _, kv := range strings.Split(s, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not name=limit", kv)
+		}
+		n, err := strconv.Atoi(kv[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%q:%v", kv, err)
+		}
+		m[kv[:i]] = n
+	}
+
+	return m, nil
+}
+
+func envInt(key string, def int) int {
+	v := cmd.GetEnvWithDefault(key, "")
+	if v == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		panic(fmt.Sprintf("init log:%s:%v", key, err))
+	}
+
+	return n
+}
+
+func envDuration(key string) time.Duration {
+	v := cmd.GetEnvWithDefault(key, "")
+	if v == "" {
+		return 0
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Sprintf("init log:%s:%v", key, err))
+	}
+
+	return d
+}
+
+// reopenOnHUP reopens the file of the default logger on SIGHUP, as sent by
+// logrotate after moving it.
+func reopenOnHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if err := std.Reopen(); err != nil {
+			fmt.Fprintln(os.Stderr, "reopen log:", err)
+		}
+	}
+}
+
+// Default returns the logger used by the package-level functions.
+func Default() *Log {
+	return std
+}
+
+// SetDefault replaces the logger used by the package-level functions.
+func SetDefault(l *Log) {
+	named.Lock()
+	defer named.Unlock()
+
+	std = l
+	syncLevels()
+}
+
+// SetFormatter replaces the formatter of l.
+func (l *Log) SetFormatter(formatter logrus.Formatter) {
+	if l.async != nil {
+		formatter = levelFormatter{Formatter: formatter, w: l.async}
+	}
+
+	l.logger.Formatter = formatter
+}
+
+// Flush logs the messages suppressed so far, then waits until the entries
+// queued by an async logger and its sinks are written.
+func (l *Log) Flush() {
+	if l.dedup != nil {
+		l.dedup.flush()
+	}
+
+	if l.async != nil {
+		l.async.Flush()
+	}
+
+	for _, h := range l.sinks {
+		h.flush()
+	}
+}
+
+// Dropped returns the number of entries an async logger or its sinks
+// dropped because a queue was full, by level.
+func (l *Log) Dropped() map[string]uint64 {
+	m := map[string]uint64{}
+	if l.async != nil {
+		m = l.async.Dropped()
+	}
+
+	for _, h := range l.sinks {
+		h.mu.Lock()
+		for level, n := range h.dropped {
+			m[level.String()] += n
+		}
+		h.mu.Unlock()
+	}
+
+	return m
+}
+
+// Flush flushes the default logger.
+func Flush() {
+	std.Flush()
+}
+
+// Reopen opens the log file of l again, if any, after it was moved away.
+func (l *Log) Reopen() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Reopen()
+}
+
+// Close writes the queued entries, closes the sinks and the log file of
+// l, if any.
+func (l *Log) Close() error {
+	if l.dedup != nil {
+		l.dedup.close()
+	}
+
+	if l.async != nil {
+		l.async.Close()
+	}
+
+	for _, h := range l.sinks {
+		if err := h.close(); err != nil {
+			fmt.Fprintln(os.Stderr, "close log sink:", err)
+		}
+	}
+
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+// Level returns the name of the lowest level l writes, e.g. "info".
+func (l *Log) Level() string {
+	return l.getLevel().String()
+}
+
+// SetLevel changes the lowest level l writes at runtime. level is one of
+// trace, debug, info, warning, error, fatal or panic. Named loggers which
+// do not set their own follow the default logger.
+func (l *Log) SetLevel(level string) error {
+	named.Lock()
+	defer named.Unlock()
+
+	if err := l.storeLevel(level); err != nil {
+		return err
+	}
+
+	if l == std {
+		syncLevels()
+	} else {
+		l.logger.SetLevel(l.getLevel())
+	}
+	return nil
+}
+
+func (l *Log) getLevel() logrus.Level {
+	if lv := atomic.LoadInt32(&l.level); lv > 0 {
+		return logrus.Level(lv - 1)
+	}
+
+	return l.logger.GetLevel()
+}
+
+// pinLevel keeps the level of l before the level of its logrus logger is
+// raised for named loggers.
+func (l *Log) pinLevel() logrus.Level {
+	lv := l.getLevel()
+	atomic.StoreInt32(&l.level, int32(lv)+1)
+
+	return lv
+}
+
+func (l *Log) storeLevel(level string) error {
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&l.level, int32(lv)+1)
+	return nil
+}
+
+// GetLevel returns the level of the default logger.
+func GetLevel() string {
+	return std.Level()
+}
+
+// SetLevel changes the level of the default logger.
+func SetLevel(level string) error {
+	return std.SetLevel(level)
+}
+
+func SetLogFormatter(formatter logrus.Formatter) {
+	std.SetFormatter(formatter)
+}
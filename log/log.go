@@ -1,224 +1,167 @@
-// +build !optimazing
-
 package log
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"os"
 	"runtime"
 	"strings"
-	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
-
-	"github.com/tinklabs/golibs/cmd"
-	"github.com/tinklabs/golibs/utils"
 )
 
-var (
-	logger *logrus.Logger
-)
-
-// Fields wraps logrus.Fields, which is a map[string]interface{}
-type Fields logrus.Fields
+// access writes the access log line of a request.
+func (l *Log) access(f Fields) {
+	level := l.accessLevel
+	// The zero level is Panic, which makes no sense here; it means unset.
+	if level == logrus.PanicLevel {
+		level = logrus.InfoLevel
+	}
 
-type bodyLogWriter struct {
-	gin.ResponseWriter
-	body *bytes.Buffer
+	l.log(level, f, "")
 }
 
-func (w bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
+// Debug logs a message at level Debug on the standard logger.
+func Debug(args ...interface{}) {
+	std.log(logrus.DebugLevel, nil, args...)
 }
 
-func Init() {
-	logger = logrus.New()
-	cf := cmd.GetCmdFlag()
-
-	logFileName := fmt.Sprintf("%s.log", cf.ServerName)
-	f, err := os.OpenFile(logFileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatal(err)
-	}
-	// Log as JSON instead of the default ASCII formatter.
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	// logger.SetFormatter(&logrus.TextFormatter{
-	// 	DisableColors: false,
-	// 	FullTimestamp: true,
-	// })
-
-	// Output to stdout instead of the default stderr
-	// Can be any io.Writer, see below for File example
-
-	// Only log the warning severity or above.
-	if cmd.IsDebug() {
-		logger.SetLevel(logrus.DebugLevel)
-		logger.SetOutput(os.Stdout)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
-		mw := io.MultiWriter(os.Stdout, f)
-		logger.SetOutput(mw)
-	}
+// DebugWithFields logs a message with fields at level Debug on the standard logger.
+func DebugWithFields(l interface{}, f Fields) {
+	std.log(logrus.DebugLevel, f, l)
 }
 
-// LoggerWithWriter instance a Logger middleware with the specified writter buffer.
-// Example: os.Stdout, a file opened in write mode, a socket...
-func Logger() gin.HandlerFunc {
-
-	return func(c *gin.Context) {
-		path := c.Request.URL.Path
-
-		buf, _ := ioutil.ReadAll(c.Request.Body)
-		rdr1 := ioutil.NopCloser(bytes.NewBuffer(buf))
-		rdr2 := ioutil.NopCloser(bytes.NewBuffer(buf))
-
-		c.Request.Body = rdr2
-
-		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = blw
-
-		// Start timer
-		start := time.Now()
-
-		// Process request
-		c.Next()
-
-		// Stop timer
-		end := time.Now()
-		latency := int64(end.Sub(start).Seconds() * 1000)
-
-		clientIP := c.ClientIP()
-		method := c.Request.Method
-		statusCode := c.Writer.Status()
-		reqStr := utils.ReadBody(rdr1)
-		if c.ContentType() == "multipart/form-data" {
-			f, _ := c.FormFile("file")
-			if f != nil {
-				reqStr = f.Filename
-			}
-		}
-		InfoWithFields("", Fields{"request-id": c.GetHeader("Request-Id"), "request": reqStr,
-			"response": blw.body.String(), "clientIP": clientIP, "path": path, "method": method,
-			"statusCode": statusCode, "latency": latency})
-
-	}
+// Debug logs a message at level Debug.
+func (l *Log) Debug(args ...interface{}) {
+	l.log(logrus.DebugLevel, nil, args...)
 }
 
-func SetLogFormatter(formatter logrus.Formatter) {
-	logger.Formatter = formatter
+// DebugWithFields logs a message with fields at level Debug.
+func (l *Log) DebugWithFields(msg interface{}, f Fields) {
+	l.log(logrus.DebugLevel, f, msg)
 }
 
-// Debug logs a message at level Debug on the standard logger.
-func Debug(args ...interface{}) {
-	if logger.Level >= logrus.DebugLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Debug(args...)
-	}
+// Info logs a message at level Info on the standard logger.
+func Info(args ...interface{}) {
+	std.log(logrus.InfoLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
-func DebugWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.DebugLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Debug(l)
-	}
+// InfoWithFields logs a message with fields at level Info on the standard logger.
+func InfoWithFields(l interface{}, f Fields) {
+	std.log(logrus.InfoLevel, f, l)
 }
 
-// Info logs a message at level Info on the standard logger.
-func Info(args ...interface{}) {
-	if logger.Level >= logrus.InfoLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Info(args...)
-	}
+// Info logs a message at level Info.
+func (l *Log) Info(args ...interface{}) {
+	l.log(logrus.InfoLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
-func InfoWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.InfoLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Info(l)
-	}
+// InfoWithFields logs a message with fields at level Info.
+func (l *Log) InfoWithFields(msg interface{}, f Fields) {
+	l.log(logrus.InfoLevel, f, msg)
 }
 
 // Warn logs a message at level Warn on the standard logger.
 func Warn(args ...interface{}) {
-	if logger.Level >= logrus.WarnLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Warn(args...)
-	}
+	std.log(logrus.WarnLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
+// WarnWithFields logs a message with fields at level Warn on the standard logger.
 func WarnWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.WarnLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Warn(l)
-	}
+	std.log(logrus.WarnLevel, f, l)
+}
+
+// Warn logs a message at level Warn.
+func (l *Log) Warn(args ...interface{}) {
+	l.log(logrus.WarnLevel, nil, args...)
+}
+
+// WarnWithFields logs a message with fields at level Warn.
+func (l *Log) WarnWithFields(msg interface{}, f Fields) {
+	l.log(logrus.WarnLevel, f, msg)
 }
 
 // Error logs a message at level Error on the standard logger.
 func Error(args ...interface{}) {
-	if logger.Level >= logrus.ErrorLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Error(args...)
-	}
+	std.log(logrus.ErrorLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
+// ErrorWithFields logs a message with fields at level Error on the standard logger.
 func ErrorWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.ErrorLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Error(l)
-	}
+	std.log(logrus.ErrorLevel, f, l)
+}
+
+// Error logs a message at level Error.
+func (l *Log) Error(args ...interface{}) {
+	l.log(logrus.ErrorLevel, nil, args...)
+}
+
+// ErrorWithFields logs a message with fields at level Error.
+func (l *Log) ErrorWithFields(msg interface{}, f Fields) {
+	l.log(logrus.ErrorLevel, f, msg)
 }
 
 // Fatal logs a message at level Fatal on the standard logger.
 func Fatal(args ...interface{}) {
-	if logger.Level >= logrus.FatalLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Fatal(args...)
-	}
+	std.log(logrus.FatalLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
+// FatalWithFields logs a message with fields at level Fatal on the standard logger.
 func FatalWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.FatalLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Fatal(l)
-	}
+	std.log(logrus.FatalLevel, f, l)
+}
+
+// Fatal logs a message at level Fatal.
+func (l *Log) Fatal(args ...interface{}) {
+	l.log(logrus.FatalLevel, nil, args...)
+}
+
+// FatalWithFields logs a message with fields at level Fatal.
+func (l *Log) FatalWithFields(msg interface{}, f Fields) {
+	l.log(logrus.FatalLevel, f, msg)
 }
 
 // Panic logs a message at level Panic on the standard logger.
 func Panic(args ...interface{}) {
-	if logger.Level >= logrus.PanicLevel {
-		entry := logger.WithFields(logrus.Fields{})
-		entry.Data["file"] = fileInfo(2)
-		entry.Panic(args...)
-	}
+	std.log(logrus.PanicLevel, nil, args...)
 }
 
-// Debug logs a message with fields at level Debug on the standard logger.
+// PanicWithFields logs a message with fields at level Panic on the standard logger.
 func PanicWithFields(l interface{}, f Fields) {
-	if logger.Level >= logrus.PanicLevel {
-		entry := logger.WithFields(logrus.Fields(f))
-		entry.Data["file"] = fileInfo(2)
-		entry.Panic(l)
+	std.log(logrus.PanicLevel, f, l)
+}
+
+// Panic logs a message at level Panic.
+func (l *Log) Panic(args ...interface{}) {
+	l.log(logrus.PanicLevel, nil, args...)
+}
+
+// PanicWithFields logs a message with fields at level Panic.
+func (l *Log) PanicWithFields(msg interface{}, f Fields) {
+	l.log(logrus.PanicLevel, f, msg)
+}
+
+func (l *Log) log(level logrus.Level, f Fields, args ...interface{}) {
+	if l.getLevel() < level {
+		return
+	}
+	if l.dedup != nil && !l.dedup.allow(level, f, args) {
+		return
+	}
+
+	l.write(level, f, args...)
+}
+
+// write logs whatever the level of l, for named loggers which check their
+// own level.
+func (l *Log) write(level logrus.Level, f Fields, args ...interface{}) {
+	entry := l.logger.WithFields(logrus.Fields(f))
+	if !l.noCaller {
+		entry.Data["file"] = fileInfo(4)
+	}
+	entry.Log(level, args...)
+
+	if level == logrus.FatalLevel {
+		l.Flush()
+		l.logger.Exit(1)
 	}
 }
 
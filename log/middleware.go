@@ -0,0 +1,114 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// LoggerWithWriter instance a Logger middleware with the specified writter buffer.
+// Example: os.Stdout, a file opened in write mode, a socket...
+func Logger() gin.HandlerFunc {
+	return std.Middleware()
+}
+
+// Middleware returns the access log middleware writing to l. Bodies are
+// redacted and truncated as configured in Options; binary bodies are
+// replaced by their type and size, and routes using SkipBody log none.
+// Successful requests are sampled as set by Options.AccessSample.
+// It also starts the request scope used by FromGin and FromContext.
+func (l *Log) Middleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+
+		reqType := c.GetHeader("Content-Type")
+		var reqBuf []byte
+		if c.Request.Body != nil && (reqType == "" || textual(reqType)) {
+			reqBuf, _ = ioutil.ReadAll(c.Request.Body)
+			c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(reqBuf))
+		}
+
+		sc := newScope(l, c)
+
+		blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		c.Writer = blw
+
+		// Start timer
+		start := time.Now()
+
+		// Process request
+		c.Next()
+
+		// Stop timer
+		end := time.Now()
+		latency := int64(end.Sub(start).Seconds() * 1000)
+
+		method := c.Request.Method
+		statusCode := c.Writer.Status()
+
+		if !l.sampled(c, statusCode, blw) {
+			return
+		}
+
+		// The request fields, including those added by handlers with With.
+		fields := sc.snapshot()
+		fields["path"], fields["method"] = path, method
+		fields["statusCode"], fields["latency"] = statusCode, latency
+
+		if !c.GetBool(skipBodyKey) {
+			if c.ContentType() == "multipart/form-data" {
+				fields["request"] = ""
+				if f, _ := c.FormFile("file"); f != nil {
+					fields["request"] = f.Filename
+				}
+			} else if reqBuf == nil && c.Request.ContentLength != 0 {
+				fields["request"] = skipped(reqType, int(c.Request.ContentLength))
+			} else {
+				fields["request"] = l.body(reqType, reqBuf)
+			}
+
+			respType := blw.Header().Get("Content-Type")
+			if blw.skip {
+				fields["response"] = skipped(respType, blw.size)
+			} else {
+				fields["response"] = l.body(respType, blw.body.Bytes())
+			}
+		}
+
+		l.access(fields)
+
+	}
+}
+
+// sampled reports whether the access log line of c is written. Failed
+// requests always are, successful ones with probability l.accessSample when
+// the access log is at level info.
+func (l *Log) sampled(c *gin.Context, status int, w *bodyLogWriter) bool {
+	if l.accessSample <= 0 || l.accessSample >= 1 {
+		return true
+	}
+	// A zero accessLevel means info, see access.
+	if l.accessLevel != logrus.InfoLevel && l.accessLevel != logrus.PanicLevel {
+		return true
+	}
+
+	if status >= 400 || len(c.Errors) > 0 {
+		return true
+	}
+	if !w.skip {
+		r := struct {
+			ErrorCode int `json:"errorCode"`
+		}{}
+		if json.Unmarshal(w.body.Bytes(), &r) == nil && r.ErrorCode != 0 {
+			return true
+		}
+	}
+
+	return rand.Float64() < l.accessSample
+}
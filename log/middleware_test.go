@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMiddlewareBodies(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	out := new(bytes.Buffer)
+	l := &Log{logger: newLogrus(logrus.InfoLevel, out), maxBody: 64, redact: redactSet([]string{"password", "phone"})}
+
+	r := gin.New()
+	r.Use(l.Middleware())
+	r.POST("/login", func(c *gin.Context) {
+		c.JSON(200, gin.H{"guest": gin.H{"Phone": "+852 1234", "name": "tink"}, "notes": strings.Repeat("x", 100)})
+	})
+	r.POST("/upload", func(c *gin.Context) {
+		c.Data(200, "image/png", []byte("\x89PNG"))
+	})
+	r.POST("/passport", SkipBody(), func(c *gin.Context) {
+		c.JSON(200, gin.H{"number": "K1234"})
+	})
+
+	line := func(method, url, ct, body string) map[string]interface{} {
+		out.Reset()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", ct)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(out.Bytes(), &m); err != nil {
+			t.Fatalf("decode %q: %v", out.String(), err)
+		}
+		return m
+	}
+
+	m := line("POST", "/login", "application/json", `{"user":{"name":"a","password_":"p4ss"},"api_key":"k3y","roomKey":"r101"}`)
+	if req := m["request"].(string); strings.Contains(req, "p4ss") || strings.Contains(req, "k3y") || !strings.Contains(req, `"name":"a"`) || !strings.Contains(req, "r101") {
+		t.Errorf("request = %s", req)
+	}
+	if resp := m["response"].(string); strings.Contains(resp, "1234") || !strings.Contains(resp, "truncated") {
+		t.Errorf("response = %s", resp)
+	}
+
+	// Truncated on a rune boundary.
+	if b := l.body("text/plain", []byte("a"+strings.Repeat("é", 40))); !utf8.ValidString(b) || !strings.HasPrefix(b, "a"+strings.Repeat("é", 31)+"...") {
+		t.Errorf("truncated = %q", b)
+	}
+
+	m = line("POST", "/upload", "application/octet-stream", "\x00\x01")
+	if m["request"] != "[application/octet-stream, 2 bytes]" || m["response"] != "[image/png, 4 bytes]" {
+		t.Errorf("binary: %v %v", m["request"], m["response"])
+	}
+
+	m = line("POST", "/passport", "application/json", `{"number":"K1234"}`)
+	if _, ok := m["request"]; ok || strings.Contains(out.String(), "K1234") {
+		t.Errorf("skipped route logged %s", out.String())
+	}
+}
+
+func TestRuntimeOptions(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	out := new(bytes.Buffer)
+	l, err := New(Options{Debug: true, DisableCaller: true, AccessLevel: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.logger.SetOutput(out)
+	l.SetLevel("info")
+
+	r := gin.New()
+	r.Use(l.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		FromGin(c).Info("handled")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	// The access line is at debug, below the level of l.
+	if lines := strings.Count(out.String(), "\n"); lines != 1 || strings.Contains(out.String(), `"file"`) {
+		t.Errorf("output = %s", out.String())
+	}
+
+	if _, err := New(Options{Debug: true, AccessLevel: "loud"}); err == nil {
+		t.Error("unknown access level accepted")
+	}
+}
@@ -0,0 +1,246 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NamedLog is the logger of a subsystem, e.g. Named("db"). It writes
+// through the default logger with a logger field, but has a level of its
+// own, so debugging can be turned on for one subsystem only.
+type NamedLog struct {
+	name string
+	// level is the lowest level written plus one, read atomically. Zero
+	// follows the level of the default logger.
+	level int32
+}
+
+// named are the named loggers by name.
+var named = struct {
+	sync.Mutex
+	m map[string]*NamedLog
+}{m: map[string]*NamedLog{}}
+
+// Named returns the logger called name, the same one on every call. It
+// writes to the default logger at the time of each call, so it may be
+// created before Init.
+func Named(name string) *NamedLog {
+	named.Lock()
+	defer named.Unlock()
+
+	return namedLocked(name)
+}
+
+func namedLocked(name string) *NamedLog {
+	n, ok := named.m[name]
+	if !ok {
+		n = &NamedLog{name: name}
+		named.m[name] = n
+	}
+
+	return n
+}
+
+// Name returns the name of n.
+func (n *NamedLog) Name() string {
+	return n.name
+}
+
+func (n *NamedLog) getLevel() logrus.Level {
+	if lv := atomic.LoadInt32(&n.level); lv > 0 {
+		return logrus.Level(lv - 1)
+	}
+
+	return std.getLevel()
+}
+
+// Level returns the name of the lowest level n writes.
+func (n *NamedLog) Level() string {
+	return n.getLevel().String()
+}
+
+// SetLevel changes the lowest level n writes. An empty level follows the
+// default logger again.
+func (n *NamedLog) SetLevel(level string) error {
+	named.Lock()
+	defer named.Unlock()
+
+	if err := n.setLevel(level); err != nil {
+		return err
+	}
+
+	syncLevels()
+	return nil
+}
+
+func (n *NamedLog) setLevel(level string) error {
+	if level == "" {
+		atomic.StoreInt32(&n.level, 0)
+		return nil
+	}
+
+	lv, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&n.level, int32(lv)+1)
+	return nil
+}
+
+// syncLevels lets the logrus logger of the default logger write the most
+// verbose level of it and the named loggers, which filter their entries
+// themselves. It runs under the lock of named.
+func syncLevels() {
+	root := std
+	level := root.pinLevel()
+	for _, n := range named.m {
+		if lv := n.getLevel(); lv > level {
+			level = lv
+		}
+	}
+
+	root.logger.SetLevel(level)
+}
+
+// Levels returns the level of the default logger followed by the levels
+// set on named loggers, e.g. "info,consul=warn,db=debug", as read by
+// SetLevels.
+func Levels() string {
+	named.Lock()
+	defer named.Unlock()
+
+	parts := []string{std.Level()}
+	for name, n := range named.m {
+		if atomic.LoadInt32(&n.level) > 0 {
+			parts = append(parts, name+"="+n.Level())
+		}
+	}
+	sort.Strings(parts[1:])
+
+	return strings.Join(parts, ",")
+}
+
+// SetLevels applies comma separated levels: a bare level sets the default
+// logger and name=level a named logger. Named loggers left out follow the
+// default logger again, and later items win, e.g. "info,db=debug". Nothing
+// changes when spec is invalid.
+func SetLevels(spec string) error {
+	root := ""
+	levels := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, level := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			name, level = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+			if name == "" {
+				return fmt.Errorf("log levels:%q has no name", item)
+			}
+		}
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return fmt.Errorf("log levels:%v", err)
+		}
+
+		if name == "" {
+			root = level
+		} else {
+			levels[name] = level
+		}
+	}
+
+	named.Lock()
+	defer named.Unlock()
+
+	if root != "" {
+		std.storeLevel(root)
+	}
+	for name, n := range named.m {
+		if _, ok := levels[name]; !ok {
+			n.setLevel("")
+		}
+	}
+	for name, level := range levels {
+		namedLocked(name).setLevel(level)
+	}
+
+	syncLevels()
+	return nil
+}
+
+// Debug logs a message at level Debug.
+func (n *NamedLog) Debug(args ...interface{}) {
+	n.log(logrus.DebugLevel, nil, args...)
+}
+
+// DebugWithFields logs a message with fields at level Debug.
+func (n *NamedLog) DebugWithFields(msg interface{}, f Fields) {
+	n.log(logrus.DebugLevel, f, msg)
+}
+
+// Info logs a message at level Info.
+func (n *NamedLog) Info(args ...interface{}) {
+	n.log(logrus.InfoLevel, nil, args...)
+}
+
+// InfoWithFields logs a message with fields at level Info.
+func (n *NamedLog) InfoWithFields(msg interface{}, f Fields) {
+	n.log(logrus.InfoLevel, f, msg)
+}
+
+// Warn logs a message at level Warn.
+func (n *NamedLog) Warn(args ...interface{}) {
+	n.log(logrus.WarnLevel, nil, args...)
+}
+
+// WarnWithFields logs a message with fields at level Warn.
+func (n *NamedLog) WarnWithFields(msg interface{}, f Fields) {
+	n.log(logrus.WarnLevel, f, msg)
+}
+
+// Error logs a message at level Error.
+func (n *NamedLog) Error(args ...interface{}) {
+	n.log(logrus.ErrorLevel, nil, args...)
+}
+
+// ErrorWithFields logs a message with fields at level Error.
+func (n *NamedLog) ErrorWithFields(msg interface{}, f Fields) {
+	n.log(logrus.ErrorLevel, f, msg)
+}
+
+// Fatal logs a message at level Fatal.
+func (n *NamedLog) Fatal(args ...interface{}) {
+	n.log(logrus.FatalLevel, nil, args...)
+}
+
+// Panic logs a message at level Panic.
+func (n *NamedLog) Panic(args ...interface{}) {
+	n.log(logrus.PanicLevel, nil, args...)
+}
+
+func (n *NamedLog) log(level logrus.Level, f Fields, args ...interface{}) {
+	if n.getLevel() < level {
+		return
+	}
+
+	fields := make(Fields, len(f)+1)
+	for k, v := range f {
+		fields[k] = v
+	}
+	fields["logger"] = n.name
+
+	l := std
+	if l.dedup != nil && !l.dedup.allow(level, fields, args) {
+		return
+	}
+
+	l.write(level, fields, args...)
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNamed(t *testing.T) {
+	old := std
+	defer SetDefault(old)
+
+	out := new(bytes.Buffer)
+	SetDefault(&Log{logger: newLogrus(logrus.InfoLevel, out), noCaller: true})
+	defer SetLevels("")
+
+	db := Named("test-db")
+	db.Debug("hidden")
+	if out.Len() != 0 {
+		t.Fatalf("debug written at info: %s", out)
+	}
+
+	if err := SetLevels("info, test-db=debug"); err != nil {
+		t.Fatal(err)
+	}
+	if l := Levels(); l != "info,test-db=debug" {
+		t.Errorf("levels = %q", l)
+	}
+
+	db.Debug("query")
+	Debug("root")
+	if s := out.String(); !strings.Contains(s, `"logger":"test-db"`) || !strings.Contains(s, "query") || strings.Contains(s, "root") {
+		t.Errorf("out = %s", s)
+	}
+
+	// Left out, the named logger follows the default one again.
+	out.Reset()
+	if err := SetLevels("warning"); err != nil {
+		t.Fatal(err)
+	}
+	db.Info("hidden")
+	Info("hidden")
+	if out.Len() != 0 || db.Level() != "warning" {
+		t.Errorf("level %s, out = %s", db.Level(), out)
+	}
+
+	if err := SetLevels("test-db=loud"); err == nil || Levels() != "warning" {
+		t.Errorf("invalid levels: %v, %s", err, Levels())
+	}
+}
@@ -0,0 +1,314 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files, <name>-<time>.log, so that they
+// sort by age. Files rotated within the same millisecond are called
+// <name>-<time>-<n>.log.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotateRetry is how long a file that failed to rotate is written to before
+// rotating is tried again.
+const rotateRetry = time.Minute
+
+// rotateOptions are the file options of Options.
+type rotateOptions struct {
+	dir        string
+	name       string
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+}
+
+// rotatingFile is a log file rotated by size and time. Rotated files are
+// compressed and pruned in the background.
+type rotatingFile struct {
+	opts rotateOptions
+
+	mu sync.Mutex
+	// file is nil after a failed open, retried by the next Write, and
+	// after Close.
+	file   *os.File
+	closed bool
+	size   int64
+	// next is when the file rotates by time, zero without RotateEvery.
+	next time.Time
+	// retry is when rotating is tried again after a failure.
+	retry time.Time
+
+	// cleanup runs one pass of compression and pruning at a time.
+	cleanup sync.Mutex
+	wg      sync.WaitGroup
+	now     func() time.Time
+	rename  func(oldpath, newpath string) error
+}
+
+func openRotating(opts rotateOptions) (*rotatingFile, error) {
+	if opts.dir == "" {
+		opts.dir = "."
+	}
+
+	if err := os.MkdirAll(opts.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f := &rotatingFile{opts: opts, now: time.Now, rename: os.Rename}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *rotatingFile) path() string {
+	return filepath.Join(f.opts.dir, f.opts.name+".log")
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size = file, info.Size()
+	if f.opts.every > 0 {
+		f.next = f.now().Truncate(f.opts.every).Add(f.opts.every)
+	}
+
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if f.closed {
+			return 0, os.ErrClosed
+		}
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := f.now()
+	bySize := f.opts.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.maxSize
+	byTime := !f.next.IsZero() && !now.Before(f.next)
+	if (bySize || byTime) && !now.Before(f.retry) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and opens a new one. When the rename
+// fails, it goes on writing to the current file and tries again after
+// rotateRetry.
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	if err := f.rename(f.path(), f.backupPath()); err != nil {
+		fmt.Fprintln(os.Stderr, "log rotate:", err)
+		f.retry = f.now().Add(rotateRetry)
+		return f.open()
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.clean()
+	}()
+
+	return nil
+}
+
+// backupPath returns a name for the current file that no backup has,
+// compressed or not.
+func (f *rotatingFile) backupPath() string {
+	base := filepath.Join(f.opts.dir, fmt.Sprintf("%s-%s", f.opts.name, f.now().Format(backupTimeFormat)))
+	path := base + ".log"
+	for n := 1; exists(path) || exists(path+".gz"); n++ {
+		path = fmt.Sprintf("%s-%d.log", base, n)
+	}
+
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+// Reopen closes and opens the file again, after an external tool such as
+// logrotate moved it away.
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	return f.open()
+}
+
+// Close closes the file and waits for the background cleanup.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	f.closed = true
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// clean compresses the rotated files and removes those beyond MaxBackups
+// or older than MaxAge.
+func (f *rotatingFile) clean() {
+	f.cleanup.Lock()
+	defer f.cleanup.Unlock()
+
+	infos, err := ioutil.ReadDir(f.opts.dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "log cleanup:", err)
+		return
+	}
+
+	prefix := f.opts.name + "-"
+	var backups []backupFile
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		// Only <name>-<time>.log[.gz], not the files of a service called
+		// <name>-worker sharing the directory.
+		stamp := strings.TrimPrefix(name, prefix)
+		switch {
+		case strings.HasSuffix(stamp, ".log"):
+			stamp = strings.TrimSuffix(stamp, ".log")
+		case strings.HasSuffix(stamp, ".log.gz"):
+			stamp = strings.TrimSuffix(stamp, ".log.gz")
+		default:
+			continue
+		}
+		seq := 0
+		if i := strings.LastIndex(stamp, "-"); i >= 0 {
+			if seq, err = strconv.Atoi(stamp[i+1:]); err != nil {
+				continue
+			}
+			stamp = stamp[:i]
+		}
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		if f.opts.compress && strings.HasSuffix(name, ".log") {
+			if err := compress(filepath.Join(f.opts.dir, name)); err != nil {
+				fmt.Fprintln(os.Stderr, "log cleanup:", err)
+				continue
+			}
+			name += ".gz"
+		}
+
+		backups = append(backups, backupFile{name: name, time: t, seq: seq})
+	}
+
+	// Newest first.
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].time.Equal(backups[j].time) {
+			return backups[i].seq > backups[j].seq
+		}
+		return backups[i].time.After(backups[j].time)
+	})
+
+	for i, b := range backups {
+		old := f.opts.maxAge > 0 && f.now().Sub(b.time) > f.opts.maxAge
+
+		if (f.opts.maxBackups > 0 && i >= f.opts.maxBackups) || old {
+			if err := os.Remove(filepath.Join(f.opts.dir, b.name)); err != nil {
+				fmt.Fprintln(os.Stderr, "log cleanup:", err)
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	name string
+	time time.Time
+	// seq orders the files rotated within the same millisecond.
+	seq int
+}
+
+// compress gzips path to path.gz and removes path.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
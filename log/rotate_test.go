@@ -0,0 +1,161 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The log of another service sharing the directory is left alone.
+	if err := ioutil.WriteFile(filepath.Join(dir, "svc-worker.log"), []byte("worker\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := openRotating(rotateOptions{dir: dir, name: "svc", maxSize: 10, maxBackups: 2, compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+		f.wg.Wait()
+	}
+
+	// logrotate moves the file away and sends SIGHUP.
+	os.Rename(filepath.Join(dir, "svc.log"), filepath.Join(dir, "moved"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("fifth\n"))
+
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+
+	want := "moved svc-20190301T000002.000.log.gz svc-20190301T000003.000.log.gz svc-worker.log svc.log"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "svc.log")); string(b) != "fifth\n" {
+		t.Errorf("svc.log = %q", b)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "svc.log")); info.Mode().Perm()&0022 != 0 {
+		t.Errorf("mode = %v", info.Mode())
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := openRotating(rotateOptions{dir: dir, name: "svc", maxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	renames := 0
+	f.rename = func(oldpath, newpath string) error {
+		renames++
+		return os.ErrPermission
+	}
+
+	// After a failed rename, rotating waits for rotateRetry.
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("write %q: %v", line, err)
+		}
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "svc.log")); string(b) != "first\nsecond\nthird\n" {
+		t.Errorf("svc.log = %q", b)
+	}
+	if renames != 1 {
+		t.Errorf("%d renames before the retry", renames)
+	}
+	now = now.Add(rotateRetry)
+	f.rename = os.Rename
+	f.Write([]byte("fourth\n"))
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "svc.log")); string(b) != "fourth\n" {
+		t.Errorf("svc.log after the retry = %q", b)
+	}
+
+	// A failed reopen is retried by the next write.
+	os.RemoveAll(dir)
+	if err := f.Reopen(); err == nil {
+		t.Fatal("reopen in a removed directory succeeded")
+	}
+	os.MkdirAll(dir, 0755)
+	if _, err := f.Write([]byte("fifth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "svc.log")); string(b) != "fifth\n" {
+		t.Errorf("svc.log = %q", b)
+	}
+}
+
+func TestRotateSameMillisecond(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := openRotating(rotateOptions{dir: dir, name: "svc", maxSize: 10, maxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		f.wg.Wait()
+	}
+	f.Close()
+
+	// The oldest of the three backups is pruned.
+	var names []string
+	infos, _ := ioutil.ReadDir(dir)
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	want := "svc-20190301T000000.000-1.log svc-20190301T000000.000-2.log svc.log"
+	if got := strings.Join(names, " "); got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "svc-20190301T000000.000-2.log")); string(b) != "third\n" {
+		t.Errorf("newest backup = %q", b)
+	}
+}
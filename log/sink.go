@@ -0,0 +1,273 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Record is a log entry handed to a sink.
+type Record struct {
+	Level logrus.Level
+	Time  time.Time
+	// JSON is the entry as a JSON object, without a trailing newline.
+	JSON []byte
+}
+
+// Sink ships log records besides stdout and the log file, see AddSink.
+type Sink interface {
+	// Send ships a batch of records.
+	Send(batch []Record) error
+	Close() error
+}
+
+// SinkOptions configures how records reach a sink.
+type SinkOptions struct {
+	// Level is the lowest level sent to the sink, info by default. Entries
+	// below the level of the logger never reach it.
+	Level string
+	// QueueSize records wait for the sink, 1024 by default. Records are
+	// dropped and counted in Dropped when it is full.
+	QueueSize int
+	// BatchSize records are sent at most at once, 100 by default, after
+	// waiting up to FlushInterval (1s) for the batch to fill.
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// AddSink sends the entries of l at or above opts.Level to s. Records are
+// queued and sent from a goroutine, so a slow sink does not slow logging
+// down.
+func (l *Log) AddSink(s Sink, opts SinkOptions) error {
+	level := logrus.InfoLevel
+	if opts.Level != "" {
+		lv, err := logrus.ParseLevel(opts.Level)
+		if err != nil {
+			return fmt.Errorf("sink level:%v", err)
+		}
+		level = lv
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	h := &sinkHook{
+		sink:      s,
+		level:     level,
+		queue:     make(chan Record, opts.QueueSize),
+		batchSize: opts.BatchSize,
+		interval:  opts.FlushInterval,
+		formatter: &logrus.JSONFormatter{},
+		dropped:   map[logrus.Level]uint64{},
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	h.idle = sync.NewCond(&h.mu)
+	go h.run()
+
+	l.logger.AddHook(h)
+	l.sinks = append(l.sinks, h)
+	return nil
+}
+
+// sinkHook queues the entries of a logrus logger for a sink.
+type sinkHook struct {
+	sink      Sink
+	level     logrus.Level
+	queue     chan Record
+	batchSize int
+	interval  time.Duration
+	formatter logrus.Formatter
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	flushes int
+	dropped map[logrus.Level]uint64
+	closed  bool
+	// kick sends the batch being filled right away.
+	kick chan struct{}
+	done chan struct{}
+}
+
+func (h *sinkHook) Levels() []logrus.Level {
+	var levels []logrus.Level
+	for _, lv := range logrus.AllLevels {
+		if lv <= h.level {
+			levels = append(levels, lv)
+		}
+	}
+
+	return levels
+}
+
+// Fire runs under the lock of the logger, so it only queues the record.
+func (h *sinkHook) Fire(e *logrus.Entry) error {
+	b, err := h.formatter.Format(e)
+	if err != nil {
+		return err
+	}
+	r := Record{Level: e.Level, Time: e.Time, JSON: bytes.TrimRight(b, "\n")}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	select {
+	case h.queue <- r:
+		h.pending++
+	default:
+		h.dropped[e.Level]++
+	}
+
+	return nil
+}
+
+func (h *sinkHook) run() {
+	defer close(h.done)
+
+	batch := make([]Record, 0, h.batchSize)
+	for r := range h.queue {
+		batch = append(batch[:0], r)
+
+		timer := time.NewTimer(h.interval)
+	fill:
+		for len(batch) < h.batchSize {
+			// Only take what is queued while flushing.
+			wait := timer.C
+			if h.flushing() {
+				wait = expired
+			}
+
+			select {
+			case r, ok := <-h.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			case <-wait:
+				break fill
+			case <-h.kick:
+				break fill
+			}
+		}
+		timer.Stop()
+
+		if err := h.sink.Send(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to send %d log records, %v\n", len(batch), err)
+		}
+
+		h.mu.Lock()
+		h.pending -= len(batch)
+		h.idle.Broadcast()
+		h.mu.Unlock()
+	}
+}
+
+// expired is a closed channel standing in for a timer that already fired.
+var expired = func() <-chan time.Time {
+	c := make(chan time.Time)
+	close(c)
+	return c
+}()
+
+func (h *sinkHook) flushing() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.flushes > 0
+}
+
+// flush waits until the queued records are sent.
+func (h *sinkHook) flush() {
+	h.mu.Lock()
+	h.flushes++
+	h.mu.Unlock()
+
+	// Wake up a batch waiting to fill.
+	select {
+	case h.kick <- struct{}{}:
+	default:
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for h.pending > 0 {
+		h.idle.Wait()
+	}
+	h.flushes--
+}
+
+func (h *sinkHook) close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+
+	<-h.done
+	return h.sink.Close()
+}
+
+// ParseSink creates a sink from a URL, as listed in LOG_SINKS:
+//
+//	syslog+udp://host:514, syslog+tcp://host:601  RFC5424 syslog
+//	udp://host:5170, tcp://host:5170              JSON lines, or Fluentd
+//	                                              forward messages with ?tag=
+//	http://host/logs, https://host/logs           JSON array batches
+//
+// The level query parameter sets SinkOptions.Level, and batch its
+// BatchSize.
+func ParseSink(rawurl string) (Sink, SinkOptions, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, SinkOptions{}, fmt.Errorf("parse sink:%v", err)
+	}
+
+	q := u.Query()
+	opts := SinkOptions{Level: q.Get("level")}
+	if b := q.Get("batch"); b != "" {
+		if opts.BatchSize, err = strconv.Atoi(b); err != nil {
+			return nil, opts, fmt.Errorf("parse sink batch:%v", err)
+		}
+	}
+
+	switch u.Scheme {
+	case "syslog+udp", "syslog+tcp":
+		return NewSyslog(SyslogOptions{
+			Network: strings.TrimPrefix(u.Scheme, "syslog+"),
+			Addr:    u.Host,
+			AppName: q.Get("app"),
+		}), opts, nil
+	case "udp", "tcp":
+		return NewNet(NetOptions{Network: u.Scheme, Addr: u.Host, Tag: q.Get("tag")}), opts, nil
+	case "http", "https":
+		q.Del("level")
+		q.Del("batch")
+		u.RawQuery = q.Encode()
+		return NewHTTP(HTTPOptions{URL: u.String()}), opts, nil
+	}
+
+	return nil, opts, fmt.Errorf("parse sink:unknown scheme %q", u.Scheme)
+}
@@ -0,0 +1,306 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// conn is a network connection dialed on first use and again after an
+// error.
+type conn struct {
+	network string
+	addr    string
+	timeout time.Duration
+
+	mu sync.Mutex
+	c  net.Conn
+}
+
+// write sends each message, reconnecting and retrying once on error.
+func (c *conn) write(msgs [][]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.c == nil {
+			if c.c, err = net.DialTimeout(c.network, c.addr, c.timeout); err != nil {
+				c.c = nil
+				continue
+			}
+		}
+
+		c.c.SetWriteDeadline(time.Now().Add(c.timeout))
+		for len(msgs) > 0 {
+			if _, err = c.c.Write(msgs[0]); err != nil {
+				break
+			}
+			msgs = msgs[1:]
+		}
+		if err == nil {
+			return nil
+		}
+
+		c.c.Close()
+		c.c = nil
+	}
+
+	return err
+}
+
+func (c *conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.c == nil {
+		return nil
+	}
+
+	err := c.c.Close()
+	c.c = nil
+	return err
+}
+
+// SyslogOptions configures a Syslog sink.
+type SyslogOptions struct {
+	// Network is udp or tcp. TCP messages are framed with their length
+	// (RFC 6587).
+	Network string
+	Addr    string
+	// AppName is the name of the process, the name of the executable by
+	// default.
+	AppName string
+	// Facility is the syslog facility, local0 (16) when zero.
+	Facility int
+	// Timeout bounds dialing and writing, 5s by default.
+	Timeout time.Duration
+}
+
+// Syslog sends records as RFC 5424 messages with the JSON entry as
+// message.
+type Syslog struct {
+	opts     SyslogOptions
+	hostname string
+	conn     *conn
+}
+
+// severities maps logrus levels to syslog severities.
+var severities = map[logrus.Level]int{
+	logrus.PanicLevel: 0,
+	logrus.FatalLevel: 2,
+	logrus.ErrorLevel: 3,
+	logrus.WarnLevel:  4,
+	logrus.InfoLevel:  6,
+	logrus.DebugLevel: 7,
+}
+
+func NewSyslog(opts SyslogOptions) *Syslog {
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.Facility == 0 {
+		opts.Facility = 16
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &Syslog{
+		opts:     opts,
+		hostname: hostname,
+		conn:     &conn{network: opts.Network, addr: opts.Addr, timeout: opts.Timeout},
+	}
+}
+
+// format returns <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+func (s *Syslog) format(r Record) []byte {
+	severity, ok := severities[r.Level]
+	if !ok {
+		severity = 7
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", s.opts.Facility*8+severity,
+		r.Time.Format(time.RFC3339Nano), s.hostname, s.opts.AppName, os.Getpid(), r.JSON)
+
+	if s.opts.Network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	return []byte(msg)
+}
+
+func (s *Syslog) Send(batch []Record) error {
+	msgs := make([][]byte, len(batch))
+	for i, r := range batch {
+		msgs[i] = s.format(r)
+	}
+
+	return s.conn.write(msgs)
+}
+
+func (s *Syslog) Close() error {
+	return s.conn.Close()
+}
+
+// NetOptions configures a Net sink.
+type NetOptions struct {
+	// Network is udp or tcp.
+	Network string
+	Addr    string
+	// Tag sends Fluentd forward messages, ["tag", time, record] in JSON,
+	// instead of the plain records.
+	Tag string
+	// Timeout bounds dialing and writing, 5s by default.
+	Timeout time.Duration
+}
+
+// Net sends records as JSON lines to a collector, one datagram per record
+// over UDP.
+type Net struct {
+	opts NetOptions
+	conn *conn
+}
+
+func NewNet(opts NetOptions) *Net {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	return &Net{opts: opts, conn: &conn{network: opts.Network, addr: opts.Addr, timeout: opts.Timeout}}
+}
+
+func (s *Net) Send(batch []Record) error {
+	var msgs [][]byte
+	buf := new(bytes.Buffer)
+	for _, r := range batch {
+		if s.opts.Tag != "" {
+			tag, _ := json.Marshal(s.opts.Tag)
+			fmt.Fprintf(buf, "[%s,%d,%s]\n", tag, r.Time.Unix(), r.JSON)
+		} else {
+			buf.Write(r.JSON)
+			buf.WriteByte('\n')
+		}
+
+		if s.opts.Network == "udp" {
+			msgs = append(msgs, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+	}
+	if buf.Len() > 0 {
+		msgs = append(msgs, buf.Bytes())
+	}
+
+	return s.conn.write(msgs)
+}
+
+func (s *Net) Close() error {
+	return s.conn.Close()
+}
+
+// HTTPOptions configures an HTTP sink.
+type HTTPOptions struct {
+	// URL receives batches as a POSTed JSON array of records.
+	URL    string
+	Header http.Header
+	// Retries is the number of retries of a failed batch, 3 by default;
+	// negative values disable them. The wait between attempts starts at
+	// RetryWait, 500ms by default, and doubles.
+	Retries   int
+	RetryWait time.Duration
+	// Client sends the batches, a client with a 10s timeout by default.
+	Client *http.Client
+}
+
+// HTTP posts batches of records to an endpoint, retrying network errors,
+// 429 and 5xx answers.
+type HTTP struct {
+	opts HTTPOptions
+}
+
+func NewHTTP(opts HTTPOptions) *HTTP {
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.RetryWait <= 0 {
+		opts.RetryWait = 500 * time.Millisecond
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &HTTP{opts: opts}
+}
+
+func (s *HTTP) Send(batch []Record) error {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('[')
+	for i, r := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(r.JSON)
+	}
+	buf.WriteByte(']')
+
+	var err error
+	wait := s.opts.RetryWait
+	for attempt := 0; attempt <= s.opts.Retries || attempt == 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+
+		var retry bool
+		if retry, err = s.post(buf.Bytes()); err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// post sends body once and reports whether a failure is worth a retry.
+func (s *HTTP) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range s.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("post logs to %s:%s", s.opts.URL, resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+func (s *HTTP) Close() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSinks(t *testing.T) {
+	l, err := New(Options{Debug: true, DisableCaller: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.logger.SetOutput(ioutil.Discard)
+
+	// TCP JSON lines collector.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	tcpLines := make(chan string, 10)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s := bufio.NewScanner(c)
+		for s.Scan() {
+			tcpLines <- s.Text()
+		}
+	}()
+
+	// UDP syslog receiver.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// HTTP endpoint failing once.
+	var mu sync.Mutex
+	var posts []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		posts = append(posts, string(b))
+		if len(posts) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	add := func(s Sink, level string) {
+		if err := l.AddSink(s, SinkOptions{Level: level, FlushInterval: time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(NewNet(NetOptions{Network: "tcp", Addr: ln.Addr().String(), Tag: "rooms"}), "debug")
+	add(NewSyslog(SyslogOptions{Network: "udp", Addr: pc.LocalAddr().String(), AppName: "rooms"}), "warning")
+	add(NewHTTP(HTTPOptions{URL: ts.URL, RetryWait: time.Millisecond}), "error")
+
+	l.Debug("d")
+	l.Warn("w")
+	l.Error("e")
+	l.Flush()
+
+	for _, want := range []string{`"msg":"d"`, `"msg":"w"`, `"msg":"e"`} {
+		select {
+		case line := <-tcpLines:
+			if !strings.HasPrefix(line, `["rooms",`) || !strings.Contains(line, want) {
+				t.Errorf("tcp line = %s, want %s", line, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tcp line %s not received", want)
+		}
+	}
+
+	buf := make([]byte, 2048)
+	var syslog []string
+	for i := 0; i < 2; i++ {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syslog = append(syslog, string(buf[:n]))
+	}
+	// local0 (16) * 8 + warning (4) and error (3).
+	if !strings.HasPrefix(syslog[0], "<132>1 ") || !strings.Contains(syslog[0], " rooms ") || !strings.HasPrefix(syslog[1], "<131>1 ") {
+		t.Errorf("syslog = %q", syslog)
+	}
+
+	mu.Lock()
+	if len(posts) != 2 || posts[1] != posts[0] || !strings.HasPrefix(posts[1], `[{`) || strings.Contains(posts[1], `"msg":"w"`) {
+		t.Errorf("posts = %q", posts)
+	}
+	mu.Unlock()
+
+	l.Close()
+}
+
+func TestParseSink(t *testing.T) {
+	s, opts, err := ParseSink("http://collector/logs?level=error&batch=10&key=a")
+	if err != nil || opts.Level != "error" || opts.BatchSize != 10 || s.(*HTTP).opts.URL != "http://collector/logs?key=a" {
+		t.Errorf("http sink %+v %+v %v", s, opts, err)
+	}
+
+	if _, _, err := ParseSink("ftp://collector"); err == nil {
+		t.Error("unknown scheme accepted")
+	}
+}
@@ -0,0 +1,231 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AWSBaseURL = "http://169.254.169.254"
+	GCPBaseURL = "http://metadata.google.internal"
+)
+
+// Provider discovers the private address of the instance the service runs
+// on. Consul agents run on every host, so that address is where the local
+// agent listens.
+type Provider interface {
+	LocalIPv4() (string, error)
+}
+
+// Options tunes the HTTP calls of a provider. Zero values take defaults.
+type Options struct {
+	// BaseURL overrides the metadata endpoint, e.g. with a local stand-in.
+	BaseURL string
+	// Timeout bounds each attempt, 2s by default.
+	Timeout time.Duration
+	// Retries is the number of extra attempts after a failure, 2 by default.
+	// Set it below zero to disable retries.
+	Retries int
+	// RetryWait is the pause between attempts, 200ms by default.
+	RetryWait time.Duration
+	// Client sends the requests, http.DefaultClient by default.
+	Client *http.Client
+}
+
+func (o Options) withDefaults(baseURL string) Options {
+	if o.BaseURL == "" {
+		o.BaseURL = baseURL
+	}
+	o.BaseURL = strings.TrimRight(o.BaseURL, "/")
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+	if o.Retries == 0 {
+		o.Retries = 2
+	} else if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.RetryWait <= 0 {
+		o.RetryWait = 200 * time.Millisecond
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+
+	return o
+}
+
+// do sends the request built by newReq, retrying on transport errors and
+// non-2xx answers, and returns the trimmed body.
+func (o Options) do(newReq func() (*http.Request, error)) (string, error) {
+	var err error
+	for i := 0; i <= o.Retries; i++ {
+		if i > 0 {
+			time.Sleep(o.RetryWait)
+		}
+
+		var body string
+		if body, err = o.try(newReq); err == nil {
+			return body, nil
+		}
+	}
+
+	return "", err
+}
+
+func (o Options) try(newReq func() (*http.Request, error)) (string, error) {
+	req, err := newReq()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+
+	resp, err := o.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s %s:%s", req.Method, req.URL, resp.Status)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// AWS reads the EC2 instance metadata with an IMDSv2 session token.
+type AWS struct {
+	Options
+	// TokenTTL is the lifetime requested for the session token, 60s by
+	// default.
+	TokenTTL time.Duration
+}
+
+func (p *AWS) LocalIPv4() (string, error) {
+	o := p.Options.withDefaults(AWSBaseURL)
+
+	ttl := p.TokenTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	token, err := o.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("PUT", o.BaseURL+"/latest/api/token", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", fmt.Sprint(int(ttl.Seconds())))
+
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("get aws metadata token:%v", err)
+	}
+
+	ip, err := o.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", o.BaseURL+"/latest/meta-data/local-ipv4", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("get aws local ipv4:%v", err)
+	}
+
+	return ip, nil
+}
+
+// GCP reads the Compute Engine metadata of the first network interface.
+type GCP struct {
+	Options
+}
+
+func (p *GCP) LocalIPv4() (string, error) {
+	o := p.Options.withDefaults(GCPBaseURL)
+
+	ip, err := o.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", o.BaseURL+"/computeMetadata/v1/instance/network-interfaces/0/ip", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("get gcp local ipv4:%v", err)
+	}
+
+	return ip, nil
+}
+
+// URL reads the address as the plain-text body of a GET on BaseURL.
+type URL struct {
+	Options
+	Header http.Header
+}
+
+func (p *URL) LocalIPv4() (string, error) {
+	if p.BaseURL == "" {
+		return "", fmt.Errorf("metadata url is not provided")
+	}
+	o := p.Options.withDefaults("")
+
+	ip, err := o.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", o.BaseURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range p.Header {
+			req.Header[k] = v
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("get local ipv4 from %s:%v", o.BaseURL, err)
+	}
+
+	return ip, nil
+}
+
+// Static is a fixed address, for hosts without a metadata service.
+type Static string
+
+func (p Static) LocalIPv4() (string, error) {
+	return string(p), nil
+}
+
+// New returns the provider called name: aws, gcp, url or static. For the
+// static provider the BaseURL of opts is the address itself.
+func New(name string, opts Options) (Provider, error) {
+	switch name {
+	case "aws":
+		return &AWS{Options: opts}, nil
+	case "gcp":
+		return &GCP{Options: opts}, nil
+	case "url":
+		return &URL{Options: opts}, nil
+	case "static":
+		if opts.BaseURL == "" {
+			return nil, fmt.Errorf("static metadata address is not provided")
+		}
+		return Static(opts.BaseURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported metadata provider: %s", name)
+	}
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAWS(t *testing.T) {
+	fails := 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("tok"))
+		case r.Method == "GET" && r.URL.Path == "/latest/meta-data/local-ipv4":
+			if fails > 0 {
+				fails--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Header.Get("X-aws-ec2-metadata-token") != "tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("10.0.0.1\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	p := &AWS{Options: Options{BaseURL: ts.URL, RetryWait: time.Millisecond}}
+	ip, err := p.LocalIPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.1" {
+		t.Errorf("got %q", ip)
+	}
+}
+
+func TestGCP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("10.0.0.2"))
+	}))
+	defer ts.Close()
+
+	ip, err := (&GCP{Options: Options{BaseURL: ts.URL}}).LocalIPv4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "10.0.0.2" {
+		t.Errorf("got %q", ip)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	p := &URL{Options: Options{BaseURL: ts.URL, Timeout: 10 * time.Millisecond, Retries: -1}}
+	if _, err := p.LocalIPv4(); err == nil {
+		t.Error("expected a timeout")
+	}
+}
+
+func TestStatic(t *testing.T) {
+	p, err := New("static", Options{BaseURL: "10.0.0.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip, _ := p.LocalIPv4(); ip != "10.0.0.3" {
+		t.Errorf("got %q", ip)
+	}
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Local counts requests in process memory. Every instance of a service
+// counts on its own.
+type Local struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+type localBucket struct {
+	// tokens and last are the token bucket state.
+	tokens float64
+	last   time.Time
+
+	// window, curr and prev are the sliding window state.
+	window int64
+	curr   int
+	prev   int
+
+	per time.Duration
+}
+
+// NewLocal returns an empty Local store.
+func NewLocal() *Local {
+	return &Local{now: time.Now, buckets: map[string]*localBucket{}}
+}
+
+func (s *Local) Allow(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: float64(limit.burst()), last: now, per: limit.Per}
+		s.buckets[key] = b
+	}
+
+	if limit.Algorithm == SlidingWindow {
+		return b.slidingWindow(now, limit), nil
+	}
+
+	return b.tokenBucket(now, limit), nil
+}
+
+func (b *localBucket) tokenBucket(now time.Time, limit Limit) Result {
+	// tokens refilled per nanosecond
+	rate := float64(limit.Rate) / float64(limit.Per)
+	burst := float64(limit.burst())
+
+	b.tokens = math.Min(burst, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	r := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	r.Remaining = int(b.tokens)
+	r.Reset = time.Duration((burst - b.tokens) / rate)
+
+	return r
+}
+
+func (b *localBucket) slidingWindow(now time.Time, limit Limit) Result {
+	window := now.UnixNano() / int64(limit.Per)
+	switch window - b.window {
+	case 0:
+	case 1:
+		b.prev, b.curr = b.curr, 0
+	default:
+		b.prev, b.curr = 0, 0
+	}
+	b.window = window
+	b.last = now
+
+	elapsed := time.Duration(now.UnixNano() % int64(limit.Per))
+	left := limit.Per - elapsed
+	count := float64(b.prev)*float64(left)/float64(limit.Per) + float64(b.curr)
+
+	r := Result{Reset: left + limit.Per}
+	if count < float64(limit.Rate) {
+		b.curr++
+		count++
+		r.Allowed = true
+	} else {
+		r.RetryAfter = left
+	}
+	r.Remaining = int(math.Max(0, float64(limit.Rate)-count))
+
+	return r
+}
+
+// sweep drops the buckets idle for more than twice their period, at most
+// once a minute.
+func (s *Local) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for k, b := range s.buckets {
+		if now.Sub(b.last) > 2*b.per {
+			delete(s.buckets, k)
+		}
+	}
+}
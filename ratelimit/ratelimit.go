@@ -0,0 +1,179 @@
+// Package ratelimit limits requests per route and per client with a token
+// bucket or a sliding window, counted in process or in redis.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+)
+
+// Algorithm is how requests are counted.
+type Algorithm int
+
+const (
+	// TokenBucket refills Rate tokens every Per up to Burst and takes one
+	// token per request, allowing short bursts.
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Rate requests in any window of length Per,
+	// estimated from the counts of the current and previous fixed windows.
+	SlidingWindow
+)
+
+// Limit allows Rate requests every Per.
+type Limit struct {
+	Rate      int
+	Per       time.Duration
+	Algorithm Algorithm
+	// Burst is the bucket size of TokenBucket, Rate by default.
+	Burst int
+}
+
+// PerSecond, PerMinute and PerHour are token bucket limits.
+func PerSecond(rate int) Limit { return Limit{Rate: rate, Per: time.Second} }
+func PerMinute(rate int) Limit { return Limit{Rate: rate, Per: time.Minute} }
+func PerHour(rate int) Limit   { return Limit{Rate: rate, Per: time.Hour} }
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Rate
+}
+
+// Result is the decision for one request.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long a limited client should wait.
+	RetryAfter time.Duration
+	// Reset is how long until the limit is fully available again.
+	Reset time.Duration
+}
+
+// Store counts requests by key.
+type Store interface {
+	Allow(key string, limit Limit) (Result, error)
+}
+
+// KeyFunc identifies the client of a request.
+type KeyFunc func(c *gin.Context) string
+
+// ByIP limits each peer IP, the RemoteAddr of the request. Behind a proxy
+// use ByForwardedIP; X-Forwarded-For is not trusted here, since clients can
+// send any value.
+func ByIP(c *gin.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return c.Request.RemoteAddr
+	}
+
+	return host
+}
+
+// ByForwardedIP limits each client IP behind trustedProxies proxies, e.g. 1
+// for a single ingress. Each proxy appends the address it saw to
+// X-Forwarded-For, so the client is taken that many hops from the right,
+// where clients cannot forge it.
+func ByForwardedIP(trustedProxies int) KeyFunc {
+	return func(c *gin.Context) string {
+		var hops []string
+		for _, h := range c.Request.Header["X-Forwarded-For"] {
+			for _, ip := range strings.Split(h, ",") {
+				if ip = strings.TrimSpace(ip); ip != "" {
+					hops = append(hops, ip)
+				}
+			}
+		}
+		hops = append(hops, ByIP(c))
+
+		i := len(hops) - 1 - trustedProxies
+		if i < 0 {
+			i = 0
+		}
+
+		return hops[i]
+	}
+}
+
+// ByHeader limits each value of a header, such as a hotel or device ID,
+// falling back to the client IP when the header is missing.
+func ByHeader(name string) KeyFunc {
+	return func(c *gin.Context) string {
+		if v := c.GetHeader(name); v != "" {
+			return name + "=" + v
+		}
+
+		return ByIP(c)
+	}
+}
+
+// ByAPIKey limits each API key sent in the X-Api-Key header.
+var ByAPIKey = ByHeader("X-Api-Key")
+
+// Options configures the middleware returned by New.
+type Options struct {
+	// Name namespaces the counters, e.g. with the route. Middleware sharing
+	// a name and a store share their counters.
+	Name  string
+	Limit Limit
+	// Key is ByIP by default.
+	Key KeyFunc
+	// Store is a new Local store by default.
+	Store Store
+}
+
+// New returns a middleware aborting requests over the limit with
+// ErrRateLimited. It sets the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, and Retry-After when limited. Requests pass
+// when the store fails.
+func New(opts Options) gin.HandlerFunc {
+	if opts.Limit.Rate <= 0 || opts.Limit.Per <= 0 {
+		panic(fmt.Sprintf("ratelimit %s: rate and per must be positive", opts.Name))
+	}
+	if opts.Key == nil {
+		opts.Key = ByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewLocal()
+	}
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+
+	return func(c *gin.Context) {
+		r, err := opts.Store.Allow(opts.Name+":"+opts.Key(c), opts.Limit)
+		if err != nil {
+			log.Error(err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(opts.Limit.Rate))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
+		c.Header("X-RateLimit-Reset", seconds(r.Reset))
+
+		if !r.Allowed {
+			c.Header("Retry-After", seconds(r.RetryAfter))
+			server.Abort(c, terr.ErrRateLimited)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// seconds rounds d up to whole seconds, as Retry-After wants.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
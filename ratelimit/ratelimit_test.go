@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+)
+
+func TestLocal(t *testing.T) {
+	for _, alg := range []Algorithm{TokenBucket, SlidingWindow} {
+		now := time.Unix(1000, 0)
+		s := NewLocal()
+		s.now = func() time.Time { return now }
+		limit := Limit{Rate: 2, Per: time.Second, Algorithm: alg}
+
+		for i, want := range []bool{true, true, false} {
+			r, _ := s.Allow("k", limit)
+			if r.Allowed != want {
+				t.Errorf("alg %d, request %d: allowed = %v", alg, i, r.Allowed)
+			}
+			if !r.Allowed && r.RetryAfter <= 0 {
+				t.Errorf("alg %d: missing retry after", alg)
+			}
+		}
+
+		if r, _ := s.Allow("other", limit); !r.Allowed {
+			t.Errorf("alg %d: keys are not independent", alg)
+		}
+
+		now = now.Add(2 * time.Second)
+		if r, _ := s.Allow("k", limit); !r.Allowed {
+			t.Errorf("alg %d: not allowed after waiting", alg)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.GET("/", New(Options{Limit: PerMinute(1), Key: ByHeader("Device-Id")}), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	get := func(device string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Device-Id", device)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("a"); w.Body.String() != "ok" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("first request: %q %v", w.Body.String(), w.Header())
+	}
+	if w := get("a"); w.Header().Get("Retry-After") == "" || w.Body.String() == "ok" {
+		t.Errorf("second request: %q %v", w.Body.String(), w.Header())
+	}
+	if w := get("b"); w.Body.String() != "ok" {
+		t.Errorf("other device: %q", w.Body.String())
+	}
+}
+
+func TestByIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:4321"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+	c := &gin.Context{Request: req}
+
+	if ip := ByIP(c); ip != "10.0.0.2" {
+		t.Errorf("by ip = %s", ip)
+	}
+	// The client forged 1.1.1.1; the ingress at 10.0.0.2 appended 203.0.113.7.
+	if ip := ByForwardedIP(1)(c); ip != "203.0.113.7" {
+		t.Errorf("by forwarded ip = %s", ip)
+	}
+	if ip := ByForwardedIP(5)(c); ip != "1.1.1.1" {
+		t.Errorf("too many proxies = %s", ip)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	for _, alg := range []Algorithm{TokenBucket, SlidingWindow} {
+		mr.FlushAll()
+		now := time.Unix(1000, 0)
+		s := NewRedis(client)
+		s.now = func() time.Time { return now }
+		limit := Limit{Rate: 2, Per: time.Second, Algorithm: alg}
+
+		for i, want := range []bool{true, true, false} {
+			r, err := s.Allow("k", limit)
+			if err != nil {
+				t.Fatalf("alg %d: %v", alg, err)
+			}
+			if r.Allowed != want {
+				t.Errorf("alg %d, request %d: allowed = %v", alg, i, r.Allowed)
+			}
+			if !r.Allowed && r.RetryAfter <= 0 {
+				t.Errorf("alg %d: missing retry after", alg)
+			}
+		}
+
+		if r, _ := s.Allow("other", limit); !r.Allowed {
+			t.Errorf("alg %d: keys are not independent", alg)
+		}
+
+		now = now.Add(2 * time.Second)
+		if r, _ := s.Allow("k", limit); !r.Allowed {
+			t.Errorf("alg %d: not allowed after waiting", alg)
+		}
+	}
+}
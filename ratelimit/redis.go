@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/tinklabs/golibs/cache"
+)
+
+// tokenBucketScript refills and takes a token atomically.
+//
+// KEYS[1] bucket hash; ARGV rate per ms, burst, now in ms, ttl in ms.
+// Returns {allowed, tokens left}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript counts the request in the current fixed window if
+// the weighted count of the previous and current windows is under the
+// limit.
+//
+// KEYS[1] current window counter, KEYS[2] previous window counter; ARGV
+// limit, window in ms, elapsed ms in the current window.
+// Returns {allowed, weighted count}.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+local count = prev * (window - elapsed) / window + curr
+
+if count >= limit then
+	return {0, tostring(count)}
+end
+
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], window * 2)
+
+return {1, tostring(count + 1)}
+`)
+
+// Redis counts requests in redis with Lua scripts, so every instance of a
+// service shares the limit.
+type Redis struct {
+	client redis.Cmdable
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedis returns a store on client, or on cache.Client when client is
+// nil. Keys are prefixed with "ratelimit:".
+func NewRedis(client redis.Cmdable) *Redis {
+	return &Redis{client: client, prefix: "ratelimit:", now: time.Now}
+}
+
+func (s *Redis) cmdable() redis.Cmdable {
+	if s.client != nil {
+		return s.client
+	}
+
+	return cache.Client
+}
+
+func (s *Redis) Allow(key string, limit Limit) (Result, error) {
+	c := s.cmdable()
+	if c == nil {
+		return Result{}, fmt.Errorf("ratelimit:cache is not initialized")
+	}
+
+	if limit.Algorithm == SlidingWindow {
+		return s.slidingWindow(c, key, limit)
+	}
+
+	return s.tokenBucket(c, key, limit)
+}
+
+func (s *Redis) tokenBucket(c redis.Cmdable, key string, limit Limit) (Result, error) {
+	ms := float64(limit.Per / time.Millisecond)
+	rate := float64(limit.Rate) / ms
+	burst := float64(limit.burst())
+	ttl := int64(burst/rate) + 1000
+
+	v, err := tokenBucketScript.Run(c, []string{s.prefix + key},
+		strconv.FormatFloat(rate, 'f', -1, 64), limit.burst(), s.now().UnixNano()/int64(time.Millisecond), ttl).Result()
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit:%v", err)
+	}
+
+	allowed, tokens, err := scriptResult(v)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration((burst-tokens)/rate) * time.Millisecond,
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration((1-tokens)/rate) * time.Millisecond
+	}
+
+	return r, nil
+}
+
+func (s *Redis) slidingWindow(c redis.Cmdable, key string, limit Limit) (Result, error) {
+	now := s.now().UnixNano()
+	window := now / int64(limit.Per)
+	elapsed := time.Duration(now % int64(limit.Per))
+	left := limit.Per - elapsed
+
+	// The hash tag keeps both windows in one redis cluster slot.
+	base := fmt.Sprintf("%s{%s}:", s.prefix, key)
+	keys := []string{base + strconv.FormatInt(window, 10), base + strconv.FormatInt(window-1, 10)}
+
+	v, err := slidingWindowScript.Run(c, keys,
+		limit.Rate, int64(limit.Per/time.Millisecond), int64(elapsed/time.Millisecond)).Result()
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit:%v", err)
+	}
+
+	allowed, count, err := scriptResult(v)
+	if err != nil {
+		return Result{}, err
+	}
+
+	r := Result{Allowed: allowed, Reset: left + limit.Per}
+	if remaining := limit.Rate - int(count); remaining > 0 {
+		r.Remaining = remaining
+	}
+	if !allowed {
+		r.RetryAfter = left
+	}
+
+	return r, nil
+}
+
+func scriptResult(v interface{}) (bool, float64, error) {
+	vs, ok := v.([]interface{})
+	if !ok || len(vs) != 2 {
+		return false, 0, fmt.Errorf("ratelimit:unexpected script result %v", v)
+	}
+
+	allowed, _ := vs[0].(int64)
+	s, _ := vs[1].(string)
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("ratelimit:unexpected script result %v", v)
+	}
+
+	return allowed == 1, n, nil
+}
@@ -0,0 +1,103 @@
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Options describes the service to generate.
+type Options struct {
+	// Name is the service name, used as SERVER_NAME, in the route prefix
+	// /api/<Name>/ and in the consul keys b2c/<Name>/...
+	Name string
+	// Module is the go module path, Name by default.
+	Module string
+	// Dir is the output directory, ./<Name> by default. Existing files in it
+	// are never overwritten.
+	Dir string
+}
+
+// Generate writes a service skeleton and returns the paths of the files it
+// created.
+func Generate(opts Options) ([]string, error) {
+	if !validName.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid service name %q: use lower case letters, digits and dashes", opts.Name)
+	}
+	if opts.Module == "" {
+		opts.Module = opts.Name
+	}
+	if opts.Dir == "" {
+		opts.Dir = opts.Name
+	}
+
+	for name := range files {
+		p := filepath.Join(opts.Dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return nil, fmt.Errorf("%s already exists", p)
+		}
+	}
+
+	var created []string
+	for _, name := range fileNames() {
+		b, err := render(name, opts)
+		if err != nil {
+			return created, err
+		}
+
+		p := filepath.Join(opts.Dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return created, err
+		}
+		if err := writeNew(p, b); err != nil {
+			return created, err
+		}
+		created = append(created, p)
+	}
+
+	return created, nil
+}
+
+func render(name string, opts Options) ([]byte, error) {
+	t, err := template.New(name).Parse(files[name])
+	if err != nil {
+		return nil, fmt.Errorf("parse %s:%v", name, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, opts); err != nil {
+		return nil, fmt.Errorf("render %s:%v", name, err)
+	}
+
+	if !strings.HasSuffix(name, ".go") {
+		return buf.Bytes(), nil
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format %s:%v", name, err)
+	}
+
+	return b, nil
+}
+
+func writeNew(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
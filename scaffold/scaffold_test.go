@@ -0,0 +1,84 @@
+package scaffold
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{Name: "hotel-room", Module: "example.com/hotel-room", Dir: dir}
+	created, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != len(files) {
+		t.Errorf("created %d files, want %d", len(created), len(files))
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"example.com/hotel-room/handler"`) {
+		t.Errorf("main.go does not import the handler package:\n%s", b)
+	}
+
+	if _, err := Generate(opts); err == nil {
+		t.Error("expected Generate to refuse overwriting files")
+	}
+
+	build(t, dir)
+}
+
+// build builds and vets the project generated in dir against this tree of
+// golibs.
+func build(t *testing.T, dir string) {
+	if testing.Short() {
+		t.Skip("building the generated project in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	golibs, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(golibs, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"mod", "edit", "-require=github.com/tinklabs/golibs@v0.0.0", "-replace=github.com/tinklabs/golibs=" + golibs},
+		{"mod", "tidy"},
+		{"build", "./..."},
+		{"vet", "./..."},
+	} {
+		c := exec.Command("go", args...)
+		c.Dir = dir
+		c.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+}
+
+func TestGenerateInvalidName(t *testing.T) {
+	if _, err := Generate(Options{Name: "Hotel Room"}); err == nil {
+		t.Error("expected an invalid name error")
+	}
+}
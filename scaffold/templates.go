@@ -0,0 +1,217 @@
+package scaffold
+
+import "sort"
+
+func fileNames() []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// files maps the path of every generated file to its template. Templates
+// are executed with Options.
+var files = map[string]string{
+	"go.mod": `module {{.Module}}
+
+go 1.11
+`,
+
+	".env.example": `# Copy to .env for local runs. Real environment variables take precedence.
+SERVER_NAME={{.Name}}
+PROFILE_ENV=dev
+DEBUG=true
+SERVER_PORT=8080
+CONSUL_ADDRESS=http://127.0.0.1
+CONSUL_PORT=8500
+DONT_CHECK_ETH_NAME=true
+# Serves the OpenAPI document on /api/{{.Name}}/openapi.json.
+SERVE_DOCS=true
+# Serves pprof, flags, config and the log level when set, on ADMIN_HOST
+# (127.0.0.1 by default).
+ADMIN_PORT=8081
+`,
+
+	".gitignore": `.env
+*.log
+/{{.Name}}
+`,
+
+	"Dockerfile": `FROM golang:1.11 AS build
+WORKDIR /src
+COPY go.mod go.sum ./
+RUN go mod download
+COPY . .
+RUN CGO_ENABLED=0 go build -o /out/{{.Name}} .
+
+FROM alpine:3.9
+RUN apk add --no-cache ca-certificates tzdata
+COPY --from=build /out/{{.Name}} /usr/local/bin/{{.Name}}
+ENV SERVER_NAME={{.Name}} PROFILE_ENV=production DEBUG=false
+EXPOSE 8080
+ENTRYPOINT ["/usr/local/bin/{{.Name}}"]
+`,
+
+	"main.go": `package main
+
+import (
+	"github.com/tinklabs/golibs/admin"
+	"github.com/tinklabs/golibs/cache"
+	"github.com/tinklabs/golibs/cmd"
+	"github.com/tinklabs/golibs/config"
+	"github.com/tinklabs/golibs/consul"
+	"github.com/tinklabs/golibs/db"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+	"github.com/tinklabs/golibs/utils"
+
+	"{{.Module}}/handler"
+)
+
+func main() {
+	// The order matters: every step reads what the previous ones set up.
+	cmd.Init()
+	log.Init()
+	consul.Init()
+	config.Init()
+	db.Init()
+	cache.Init()
+	server.Init()
+	admin.Init()
+
+	handler.Register(server.Default())
+
+	go server.Start()
+	go admin.Start()
+
+	<-utils.Quit()
+	admin.Stop()
+	server.Stop()
+}
+`,
+
+	"errcode/errcode.go": `// Package errcode holds the error codes of {{.Name}}. Codes from 10000 to
+// 29999 are reserved by golibs; pick service codes above them. Codes from
+// 30000 to 39999 are answered with 400 when status mapping is on.
+package errcode
+
+import (
+	terr "github.com/tinklabs/golibs/error"
+)
+
+var (
+	ErrUnknownName = &terr.TError{Code: 30000, Desc: "unknown name"}
+)
+`,
+
+	"handler/handler.go": `package handler
+
+import (
+	"github.com/tinklabs/golibs/server"
+)
+
+// Register adds the routes of the service to s.
+func Register(s *server.Server) {
+	s.Register("v1", "POST", "/hello", Hello)
+}
+`,
+
+	"handler/hello.go": `package handler
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/server"
+	"github.com/tinklabs/golibs/utils"
+
+	"{{.Module}}/errcode"
+)
+
+type HelloParam struct {
+	Name string ` + "`" + `mapstructure:"name" validate:"required"` + "`" + `
+}
+
+type HelloData struct {
+	Message string ` + "`" + `json:"message"` + "`" + `
+}
+
+func Hello(c *gin.Context) {
+	p := &HelloParam{}
+	if err := utils.Decode(c.GetStringMap("param"), p); err != nil {
+		log.Warn(err)
+		server.Fail(c, terr.ErrRequest.AddExtra(err.Error()))
+		return
+	}
+
+	if err := server.Validate(p); err != nil {
+		log.Warn(err)
+		server.Fail(c, terr.ErrRequest.AddExtra("name is required"))
+		return
+	}
+
+	if p.Name == "nobody" {
+		server.Fail(c, errcode.ErrUnknownName)
+		return
+	}
+
+	server.OK(c, &HelloData{Message: fmt.Sprintf("hello, %s", p.Name)})
+}
+`,
+
+	"handler/hello_test.go": `package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tinklabs/golibs/server"
+
+	"{{.Module}}/errcode"
+)
+
+func hello(t *testing.T, name string) *server.Response {
+	s := server.New(server.Options{Name: "{{.Name}}"})
+	Register(s)
+
+	body := ` + "`" + `{"common":{"msgType":"request","timestamp":1},"param":{"name":"` + "`" + ` + name + ` + "`" + `"}}` + "`" + `
+	req := httptest.NewRequest("POST", "/api/{{.Name}}/v1/hello", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	r := &server.Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+
+	return r
+}
+
+func TestHello(t *testing.T) {
+	r := hello(t, "tink")
+	if r.ErrorCode != 0 {
+		t.Fatalf("errorCode = %d, %s", r.ErrorCode, r.ErrorMsg)
+	}
+
+	data, _ := r.Data.(map[string]interface{})
+	if data["message"] != "hello, tink" {
+		t.Errorf("data = %v", r.Data)
+	}
+}
+
+func TestHelloUnknown(t *testing.T) {
+	if r := hello(t, "nobody"); r.ErrorCode != errcode.ErrUnknownName.Code {
+		t.Errorf("errorCode = %d", r.ErrorCode)
+	}
+}
+`,
+}
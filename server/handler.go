@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	validator "gopkg.in/go-playground/validator.v9"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+	"github.com/tinklabs/golibs/utils"
+)
+
+var (
+	ginContextType = reflect.TypeOf(&gin.Context{})
+	contextType    = reflect.TypeOf((*context.Context)(nil)).Elem()
+	terrType       = reflect.TypeOf(&terr.TError{})
+)
+
+// Handle registers a typed handler, see Typed.
+func Handle(version, method, source string, fn interface{}, opts ...RouteOption) {
+	Default().Handle(version, method, source, fn, opts...)
+}
+
+// Handle registers a typed handler, see Typed. Its request and response
+// types are described in the OpenAPI document.
+func (s *Server) Handle(version, method, source string, fn interface{}, opts ...RouteOption) {
+	h, req, resp := typed(fn)
+	s.Register(version, method, source, h, append([]RouteOption{types(req, resp)}, opts...)...)
+}
+
+// Typed adapts fn to a gin handler. fn must look like
+//
+//	func(ctx *gin.Context, req *Req) (*Resp, *terr.TError)
+//
+// where ctx may also be a context.Context, which receives the request
+// context. Param is decoded into a new Req with utils.Decode, or
+// utils.WeakDecode under PolicyQuery, and validated with Validate; failures
+// answer ErrRequest. A non-nil TError answers Fail,
+// otherwise Resp is sent with OK. Typed panics if fn has another shape.
+func Typed(fn interface{}) gin.HandlerFunc {
+	h, _, _ := typed(fn)
+	return h
+}
+
+func typed(fn interface{}) (h gin.HandlerFunc, req, resp reflect.Type) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 2 {
+		panic(fmt.Sprintf("typed handler %s: want func(ctx, *Req) (*Resp, *terr.TError)", t))
+	}
+
+	ctxIn := t.In(0)
+	if ctxIn != ginContextType && ctxIn != contextType {
+		panic(fmt.Sprintf("typed handler %s: first argument must be *gin.Context or context.Context", t))
+	}
+
+	reqIn := t.In(1)
+	if reqIn.Kind() != reflect.Ptr || reqIn.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("typed handler %s: second argument must be a pointer to a struct", t))
+	}
+
+	if t.Out(1) != terrType {
+		panic(fmt.Sprintf("typed handler %s: second result must be *terr.TError", t))
+	}
+
+	h = func(c *gin.Context) {
+		req := reflect.New(reqIn.Elem())
+
+		decode := utils.Decode
+		if c.GetBool(paramFromQuery) {
+			decode = utils.WeakDecode
+		}
+
+		if err := decode(c.GetStringMap("param"), req.Interface()); err != nil {
+			log.Warn(err)
+			Fail(c, terr.ErrRequest.AddExtra("param type is incorrect"))
+			return
+		}
+
+		if err := Validate(req.Interface()); err != nil {
+			log.Warn(err)
+			Fail(c, terr.ErrRequest.AddExtra(validationExtra(err)))
+			return
+		}
+
+		ctx := reflect.ValueOf(c)
+		if ctxIn == contextType {
+			ctx = reflect.ValueOf(c.Request.Context())
+		}
+
+		out := v.Call([]reflect.Value{ctx, req})
+
+		if e := out[1].Interface().(*terr.TError); e != nil {
+			Fail(c, e)
+			return
+		}
+
+		OK(c, nilIfEmpty(out[0]))
+	}
+
+	return h, reqIn, t.Out(0)
+}
+
+// validationExtra names the fields that failed validation, e.g.
+// "name:required,pageSize:lte".
+func validationExtra(err error) string {
+	ves, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err.Error()
+	}
+
+	fields := make([]string, 0, len(ves))
+	for _, fe := range ves {
+		fields = append(fields, fmt.Sprintf("%s:%s", fe.Field(), fe.Tag()))
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// nilIfEmpty turns nil pointers, maps and slices into an untyped nil so the
+// data field is omitted from the response.
+func nilIfEmpty(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	}
+
+	return v.Interface()
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+
+	terr "github.com/tinklabs/golibs/error"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+)
+
+// OpenAPI returns an OpenAPI 3 document describing the Register'ed routes.
+// Typed handlers get the schemas of their Param and Data wrapped in the
+// Request and Response envelopes.
+func (s *Server) OpenAPI() map[string]interface{} {
+	g := &schemaGen{schemas: map[string]interface{}{}, names: map[schemaKey]string{}}
+
+	g.schemas["Common"] = g.schema(reflect.TypeOf(Common{}), "json")
+	g.schemas["PageInfo"] = g.schema(reflect.TypeOf(PageInfo{}), "json")
+	g.schemas["Request"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"common", "param"},
+		"properties": map[string]interface{}{
+			"common": ref("Common"),
+			"param":  map[string]interface{}{"type": "object"},
+		},
+	}
+	g.schemas["Response"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"common", "errorCode", "errorMsg"},
+		"properties": map[string]interface{}{
+			"common":    ref("Common"),
+			"pageInfo":  ref("PageInfo"),
+			"total":     map[string]interface{}{"type": "integer"},
+			"errorCode": map[string]interface{}{"type": "integer"},
+			"errorMsg":  map[string]interface{}{"type": "string"},
+			"data":      map[string]interface{}{},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	versions := map[string]bool{}
+	for _, rt := range s.routes {
+		versions[rt.version] = true
+
+		path, params := openAPIPath(rt.path)
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+
+		op := g.operation(rt, s.policy(rt), s.opts.StatusMapping)
+		if len(params) > 0 {
+			qs, _ := op["parameters"].([]interface{})
+			op["parameters"] = append(params, qs...)
+		}
+
+		ms := []string{rt.method}
+		if rt.method == "ANY" {
+			ms = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+		}
+		for _, m := range ms {
+			item[strings.ToLower(m)] = op
+		}
+	}
+
+	vs := make([]string, 0, len(versions))
+	for v := range versions {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   s.opts.Name,
+			"version": strings.Join(vs, ","),
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.schemas},
+	}
+}
+
+func (s *Server) serveDocs(c *gin.Context) {
+	c.JSON(http.StatusOK, s.OpenAPI())
+}
+
+func (g *schemaGen) operation(rt *route, p Policy, statusMapping bool) map[string]interface{} {
+	var request map[string]interface{}
+	switch p {
+	case PolicyEnvelope:
+		request = ref("Request")
+		if rt.req != nil {
+			request = map[string]interface{}{
+				"allOf": []interface{}{
+					ref("Request"),
+					map[string]interface{}{
+						"properties": map[string]interface{}{"param": g.schema(rt.req, "mapstructure")},
+					},
+				},
+			}
+		}
+	case PolicyRawJSON:
+		request = map[string]interface{}{"type": "object"}
+		if rt.req != nil {
+			request = g.schema(rt.req, "mapstructure")
+		}
+	}
+
+	response := ref("Response")
+	if rt.resp != nil {
+		response = map[string]interface{}{
+			"allOf": []interface{}{
+				ref("Response"),
+				map[string]interface{}{
+					"properties": map[string]interface{}{"data": g.schema(rt.resp, "json")},
+				},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "Response envelope, errorCode is 0 on success.",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": response},
+			},
+		},
+	}
+
+	// Errors are listed under their HTTP status when status mapping is on,
+	// and under 200 otherwise.
+	byStatus := map[int][]*terr.TError{}
+	for _, e := range rt.errors {
+		status := http.StatusOK
+		if statusMapping {
+			status = e.HTTPStatus()
+		}
+		byStatus[status] = append(byStatus[status], e)
+	}
+	for status, errs := range byStatus {
+		codes := make([]interface{}, 0, len(errs))
+		lines := make([]string, 0, len(errs))
+		for _, e := range errs {
+			codes = append(codes, map[string]interface{}{"code": e.Code, "desc": e.Desc})
+			lines = append(lines, fmt.Sprintf("- %d: %s", e.Code, e.Desc))
+		}
+
+		key := fmt.Sprint(status)
+		desc := "Possible error codes:\n" + strings.Join(lines, "\n")
+		if r, ok := responses[key].(map[string]interface{}); ok {
+			desc = r["description"].(string) + " " + desc
+		}
+		responses[key] = map[string]interface{}{
+			"description": desc,
+			"x-errors":    codes,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": response},
+			},
+		}
+	}
+
+	op := map[string]interface{}{
+		"tags":      []string{rt.version},
+		"responses": responses,
+	}
+	if rt.summary != "" {
+		op["summary"] = rt.summary
+	}
+	if request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": p == PolicyEnvelope,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": request},
+			},
+		}
+	}
+	if p == PolicyQuery && rt.req != nil {
+		op["parameters"] = g.queryParameters(rt.req)
+	}
+
+	return op
+}
+
+// queryParameters describes the top level fields of req as query
+// parameters.
+func (g *schemaGen) queryParameters(req reflect.Type) []interface{} {
+	for req.Kind() == reflect.Ptr {
+		req = req.Elem()
+	}
+
+	props := map[string]interface{}{}
+	var required []string
+	g.fields(req, "mapstructure", props, &required)
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "query",
+			"required": hasString(required, name),
+			"schema":   props[name],
+		})
+	}
+
+	return params
+}
+
+func hasString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openAPIPath turns gin path parameters (:id, *path) into OpenAPI ones.
+func openAPIPath(path string) (string, []interface{}) {
+	var params []interface{}
+
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if p == "" || (p[0] != ':' && p[0] != '*') {
+			continue
+		}
+
+		name := p[1:]
+		parts[i] = "{" + name + "}"
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaGen builds JSON schemas from go types. Named structs go to the
+// components, keyed by type name.
+type schemaGen struct {
+	schemas map[string]interface{}
+	names   map[schemaKey]string
+}
+
+// schemaKey names a component: the same type read with another tag has
+// other field names.
+type schemaKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// schema describes t. tag is the struct tag holding the field names:
+// mapstructure for Param, which is decoded by utils.Decode, and json
+// otherwise.
+func (g *schemaGen) schema(t reflect.Type, tag string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case decimalType:
+		return map[string]interface{}{"type": "number"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem(), tag)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem(), tag)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, tag)
+		}
+		return ref(g.component(t, tag))
+	}
+
+	return map[string]interface{}{}
+}
+
+func (g *schemaGen) component(t reflect.Type, tag string) string {
+	k := schemaKey{t, tag}
+	if name, ok := g.names[k]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for i := 2; g.schemas[name] != nil; i++ {
+		name = fmt.Sprintf("%s%d", t.Name(), i)
+	}
+
+	// Reserve the name before describing the fields, for recursive types.
+	g.names[k] = name
+	g.schemas[name] = map[string]interface{}{}
+	g.schemas[name] = g.object(t, tag)
+
+	return name
+}
+
+func (g *schemaGen) object(t reflect.Type, tag string) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+
+	g.fields(t, tag, props, &required)
+
+	o := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+
+	return o
+}
+
+func (g *schemaGen) fields(t reflect.Type, tag string, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		parts := strings.SplitN(f.Tag.Get(tag), ",", 2)
+		if parts[0] == "-" {
+			continue
+		}
+		name, opts := f.Name, ""
+		if parts[0] != "" {
+			name = parts[0]
+		}
+		if len(parts) > 1 {
+			opts = parts[1]
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// Embedded structs are flattened by json when they have no name,
+		// and by mapstructure with squash only.
+		squash := hasRule(opts, "squash") || (tag == "json" && parts[0] == "")
+		if f.Anonymous && ft.Kind() == reflect.Struct && squash {
+			g.fields(ft, tag, props, required)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		props[name] = g.schema(f.Type, tag)
+		if hasRule(f.Tag.Get("validate"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func hasRule(rules, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		if r == rule {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+)
+
+// Policy is how a route's request is checked and turned into Param.
+type Policy int
+
+const (
+	// PolicyEnvelope requires a JSON body with common and param.
+	PolicyEnvelope Policy = iota
+	// PolicyRawJSON takes a bare JSON object body, if any, as Param. It suits
+	// webhooks from third parties.
+	PolicyRawJSON
+	// PolicyQuery takes the query string as Param. Values are strings, or
+	// lists of strings when repeated, and typed handlers decode them weakly.
+	PolicyQuery
+	// PolicyNone checks nothing and sets no Param, e.g. for health probes
+	// and file downloads.
+	PolicyNone
+)
+
+const paramFromQuery = "paramFromQuery"
+
+// WithPolicy sets the check policy of the route, overriding the policies
+// of the server.
+func WithPolicy(p Policy) RouteOption {
+	return func(r *route) {
+		r.policy = &p
+	}
+}
+
+// SetPolicy checks every route under the path prefix with p. The longest
+// matching prefix wins, and the policy of a route wins over prefixes.
+func (s *Server) SetPolicy(prefix string, p Policy) {
+	if s.policies == nil {
+		s.policies = map[string]Policy{}
+	}
+	s.policies[prefix] = p
+}
+
+func (s *Server) policy(rt *route) Policy {
+	if rt.policy != nil {
+		return *rt.policy
+	}
+
+	p, longest := s.opts.Policy, -1
+	for prefix, v := range s.policies {
+		if strings.HasPrefix(rt.path, prefix) && len(prefix) > longest {
+			p, longest = v, len(prefix)
+		}
+	}
+
+	return p
+}
+
+// check checks requests to rt with the policy in force when they arrive.
+func (s *Server) check(rt *route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkPolicy(c, s.policy(rt))
+	}
+}
+
+// checkOther checks requests to the routes added on the router directly,
+// rather than with Register, with the policy of their path. The routes of
+// Register are checked by their own handlers, and the OpenAPI document is
+// not checked.
+func (s *Server) checkOther(c *gin.Context) {
+	path := c.Request.URL.Path
+	if (s.opts.DocsPath != "" && path == s.opts.DocsPath) || s.registered(c.Request.Method, path) {
+		return
+	}
+
+	checkPolicy(c, s.policy(&route{path: path}))
+}
+
+// registered reports whether a route added by Register matches method and
+// path.
+func (s *Server) registered(method, path string) bool {
+	for _, rt := range s.routes {
+		if (rt.method == method || rt.method == "ANY") && matchPath(rt.path, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPath reports whether path matches the gin route pattern, with
+// :param and *catchAll segments.
+func matchPath(pattern, path string) bool {
+	ps, qs := strings.Split(pattern, "/"), strings.Split(path, "/")
+	for i, p := range ps {
+		switch {
+		case strings.HasPrefix(p, "*"):
+			return i < len(qs)
+		case i >= len(qs):
+			return false
+		case strings.HasPrefix(p, ":"):
+			if qs[i] == "" {
+				return false
+			}
+		case p != qs[i]:
+			return false
+		}
+	}
+
+	return len(ps) == len(qs)
+}
+
+// Check is the middleware enforcing PolicyEnvelope.
+func Check() gin.HandlerFunc {
+	return CheckWith(PolicyEnvelope)
+}
+
+// CheckWith returns the middleware enforcing p.
+func CheckWith(p Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkPolicy(c, p)
+	}
+}
+
+func checkPolicy(c *gin.Context, p Policy) {
+	if p == PolicyNone || c.ContentType() == "multipart/form-data" {
+		c.Next()
+		return
+	}
+
+	// HEAD and OPTIONS requests carry no body.
+	if c.Request.Method == "HEAD" || c.Request.Method == "OPTIONS" {
+		c.Next()
+		return
+	}
+
+	var param map[string]interface{}
+	switch p {
+	case PolicyRawJSON:
+		body, ok := readBody(c)
+		if !ok {
+			return
+		}
+
+		param = map[string]interface{}{}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := json.Unmarshal(body, &param); err != nil {
+				log.Warn(err)
+				Abort(c, terr.ErrRequest.AddExtra("json format is incorrect"))
+				return
+			}
+		}
+	case PolicyQuery:
+		param = map[string]interface{}{}
+		for k, v := range c.Request.URL.Query() {
+			if len(v) == 1 {
+				param[k] = v[0]
+			} else {
+				param[k] = v
+			}
+		}
+		c.Set(paramFromQuery, true)
+	default:
+		body, ok := readBody(c)
+		if !ok {
+			return
+		}
+
+		r := Request{}
+		if err := json.Unmarshal(body, &r); err != nil {
+			log.Warn(err)
+			Abort(c, terr.ErrRequest.AddExtra("json format is incorrect"))
+			return
+		}
+
+		if err := validate.Struct(&r); err != nil {
+			log.Warn(err)
+			Abort(c, terr.ErrRequest.AddExtra("common and param is required"))
+			return
+		}
+
+		param = r.Param
+	}
+
+	for _, name := range []string{"pageIndex", "pageSize"} {
+		if !setPage(c, p, param, name) {
+			return
+		}
+	}
+
+	c.Set("param", param)
+
+	c.Next()
+}
+
+// readBody reads the request body and puts it back for later handlers,
+// such as signature checks. It aborts and returns false on failure.
+func readBody(c *gin.Context) ([]byte, bool) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Warn(err)
+		Abort(c, terr.ErrRequest.AddExtra("read body failed"))
+		return nil, false
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	return body, true
+}
+
+// setPage copies pageIndex or pageSize from param, or else from the query
+// string, into the context. It aborts and returns false if the value is not
+// an int.
+func setPage(c *gin.Context, p Policy, param map[string]interface{}, name string) bool {
+	v, isExist := param[name]
+	fromQuery := p == PolicyQuery
+	if !isExist {
+		if v, isExist = c.GetQuery(name); !isExist {
+			return true
+		}
+		fromQuery = true
+	}
+
+	n, ok := 0, false
+	switch v := v.(type) {
+	case float64:
+		n, ok = int(v), true
+	case string:
+		if fromQuery {
+			var err error
+			n, err = strconv.Atoi(v)
+			ok = err == nil
+		}
+	}
+
+	if !ok {
+		log.Error(name + " type is wrong")
+		Abort(c, terr.ErrRequest.AddExtra(fmt.Sprintf("%s type should be int", name)))
+		return false
+	}
+
+	c.Set(name, n)
+	return true
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+)
+
+// PanicReporter sends a recovered panic to an error-reporting service.
+// recovered is the value passed to panic and stack the goroutine stack at
+// the time of the panic.
+type PanicReporter func(c *gin.Context, recovered interface{}, stack []byte)
+
+// Recovery recovers panics in later handlers, logs them with their stack
+// and request fields to l, or the default logger when l is nil, calls
+// report if set, and answers Abort(c, terr.ErrServer).
+func Recovery(l *log.Log, report PanicReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			stack := debug.Stack()
+			logger := l
+			if logger == nil {
+				logger = log.Default()
+			}
+
+			brokenPipe := isBrokenPipe(recovered)
+			fields := log.FromGin(c).Fields()
+			fields["path"] = c.Request.URL.Path
+			fields["method"] = c.Request.Method
+			fields["brokenPipe"] = brokenPipe
+			fields["stack"] = string(stack)
+			logger.ErrorWithFields(fmt.Sprintf("panic recovered:%v", recovered), fields)
+
+			if report != nil && !brokenPipe {
+				report(c, recovered, stack)
+			}
+
+			// Nothing can be written on a dead connection or after the
+			// handler started its response.
+			if brokenPipe || c.Writer.Written() {
+				c.Abort()
+				return
+			}
+
+			Abort(c, terr.ErrServer)
+		}()
+
+		c.Next()
+	}
+}
+
+// isBrokenPipe reports whether the panic comes from a client that went
+// away, which is not worth an error report.
+func isBrokenPipe(recovered interface{}) bool {
+	ne, ok := recovered.(*net.OpError)
+	if !ok {
+		return false
+	}
+
+	se, ok := ne.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/log"
+)
+
+// methods are the methods accepted by Register. ANY matches every method.
+var methods = map[string]bool{
+	"GET":     true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"ANY":     true,
+}
+
+// route is what Register knows about an endpoint.
+type route struct {
+	version string
+	method  string
+	path    string
+
+	middleware []gin.HandlerFunc
+	// policy overrides the check policies of the server when set.
+	policy *Policy
+	// timeout overrides the handler timeout of the server when set.
+	timeout time.Duration
+
+	summary string
+	// req and resp are the Param and Data types of typed handlers.
+	req    reflect.Type
+	resp   reflect.Type
+	errors []*terr.TError
+}
+
+// RouteOption tunes a route passed to Register or Handle.
+type RouteOption func(*route)
+
+// Middleware runs handlers before the route handler, after the middleware
+// of its group.
+func Middleware(handlers ...gin.HandlerFunc) RouteOption {
+	return func(r *route) {
+		r.middleware = append(r.middleware, handlers...)
+	}
+}
+
+// Summary describes the route in the OpenAPI document.
+func Summary(summary string) RouteOption {
+	return func(r *route) {
+		r.summary = summary
+	}
+}
+
+// Errors lists the TErrors the route may answer, for the OpenAPI document.
+func Errors(errs ...*terr.TError) RouteOption {
+	return func(r *route) {
+		r.errors = append(r.errors, errs...)
+	}
+}
+
+// Timeout bounds the handling of the route, overriding Options.Timeout.
+// The handler only stops at the deadline if it honours
+// c.Request.Context(), see Server.deadline.
+func Timeout(d time.Duration) RouteOption {
+	return func(r *route) {
+		r.timeout = d
+	}
+}
+
+func types(req, resp reflect.Type) RouteOption {
+	return func(r *route) {
+		r.req, r.resp = req, resp
+	}
+}
+
+func (s *Server) register(version, prefix string, middleware []gin.HandlerFunc,
+	method, source string, callback gin.HandlerFunc, opts []RouteOption) {
+	if !methods[method] {
+		panic(fmt.Sprintf("unsupported method: %s", method))
+	}
+
+	url := fmt.Sprintf("/api/%s/%s%s%s", s.opts.Name, version, prefix, source)
+
+	for _, r := range s.routes {
+		if r.path == url && (r.method == method || r.method == "ANY" || method == "ANY") {
+			panic(fmt.Sprintf("duplicate route: %s %s is already registered as %s", method, url, r.method))
+		}
+	}
+
+	rt := &route{version: version, method: method, path: url}
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	handlers := make([]gin.HandlerFunc, 0, len(middleware)+len(rt.middleware)+4)
+	handlers = append(handlers, logRoute(rt), s.deadline(rt), s.check(rt))
+	handlers = append(handlers, middleware...)
+	handlers = append(handlers, rt.middleware...)
+	handlers = append(handlers, callback)
+
+	defer func() {
+		// gin panics on conflicting wildcards, e.g. /:id and /:name.
+		if r := recover(); r != nil {
+			panic(fmt.Sprintf("register %s %s:%v", method, url, r))
+		}
+	}()
+
+	if method == "ANY" {
+		s.router.Any(url, handlers...)
+	} else {
+		s.router.Handle(method, url, handlers...)
+	}
+
+	s.routes = append(s.routes, rt)
+}
+
+// logRoute adds the route to the fields of the request log entry.
+func logRoute(rt *route) gin.HandlerFunc {
+	name := rt.method + " " + rt.path
+	return func(c *gin.Context) {
+		log.FromGin(c).With(log.Fields{"route": name})
+	}
+}
+
+// Group registers routes under a common version and path prefix, with
+// middleware shared by all of them.
+type Group struct {
+	server     *Server
+	version    string
+	prefix     string
+	middleware []gin.HandlerFunc
+}
+
+// NewGroup returns a group of the default server, see Server.Group.
+func NewGroup(version string, middleware ...gin.HandlerFunc) *Group {
+	return Default().Group(version, middleware...)
+}
+
+// Group returns a group registering routes under /api/<name>/<version>.
+func (s *Server) Group(version string, middleware ...gin.HandlerFunc) *Group {
+	return &Group{server: s, version: version, middleware: middleware}
+}
+
+// Group returns a sub group under prefix, running middleware after the
+// middleware of g.
+func (g *Group) Group(prefix string, middleware ...gin.HandlerFunc) *Group {
+	mw := make([]gin.HandlerFunc, 0, len(g.middleware)+len(middleware))
+	mw = append(mw, g.middleware...)
+	mw = append(mw, middleware...)
+
+	return &Group{server: g.server, version: g.version, prefix: g.prefix + prefix, middleware: mw}
+}
+
+// Register adds a route under /api/<name>/<version><prefix><source>.
+func (g *Group) Register(method, source string, callback func(*gin.Context), opts ...RouteOption) {
+	g.server.register(g.version, g.prefix, g.middleware, method, source, callback, opts)
+}
+
+// Handle registers a typed handler, see Typed.
+func (g *Group) Handle(method, source string, fn interface{}, opts ...RouteOption) {
+	h, req, resp := typed(fn)
+	g.Register(method, source, h, append([]RouteOption{types(req, resp)}, opts...)...)
+}
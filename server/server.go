@@ -2,12 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/tinklabs/golibs/certs"
 	"github.com/tinklabs/golibs/cmd"
 	"github.com/tinklabs/golibs/consul"
 	terr "github.com/tinklabs/golibs/error"
@@ -15,75 +18,322 @@ import (
 	"github.com/tinklabs/golibs/utils"
 )
 
-var (
-	server *http.Server
+// std is the server behind the package-level functions.
+var std *Server
+
+const serverKey = "server"
+
+// Options configures a Server created by New.
+type Options struct {
+	// Name is the service name used in the /api/<Name>/<version> prefix.
+	Name string
+	Port int
+	// Debug keeps gin in debug mode.
+	Debug bool
+	// Consul registers the service on Start and deregisters it on Stop.
+	// Registration is skipped when it is nil.
+	Consul *consul.ConsulClient
+	// Log writes the access log. The default logger is used when it is nil.
+	Log *log.Log
+	// DocsPath serves the OpenAPI document of the registered routes when it
+	// is not empty.
+	DocsPath string
+	// Policy is the check policy of routes not covered by SetPolicy or
+	// WithPolicy, PolicyEnvelope by default.
+	Policy Policy
+	// StatusMapping answers Fail and Abort with the HTTP status of the
+	// TError instead of 200. The JSON envelope is the same.
+	StatusMapping bool
+	// ReportPanic receives the panics recovered in handlers. It can be set
+	// later with SetPanicReporter, e.g. on the server created by Init.
+	ReportPanic PanicReporter
+	// Timeout bounds the handling of every route, unless the route sets its
+	// own with the Timeout option. Routes have no deadline when it is zero.
+	// At the deadline the caller gets ErrTimeout, but the handler only stops
+	// working if it passes c.Request.Context() down and gives up once it is
+	// done; responses of routes with a deadline are buffered.
+	Timeout time.Duration
+	// ReadTimeout, WriteTimeout and IdleTimeout are the timeouts of the
+	// http.Server, 30s, 60s and 120s by default. Negative values disable
+	// them. WriteTimeout should exceed the route timeouts.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// TLS serves HTTPS with the certificates of the store when set. The
+	// server owns it: Stop closes it.
+	TLS *certs.Store
+	// ClientAuth selects mutual TLS, e.g. tls.RequireAndVerifyClientCert
+	// verifies client certificates against the CA bundle of TLS.
+	ClientAuth tls.ClientAuthType
+}
+
+// Server is an HTTP server with the standard middleware installed.
+type Server struct {
+	opts   Options
 	router *gin.Engine
-)
+	server *http.Server
+	routes []*route
+	// policies are the check policies by path prefix.
+	policies map[string]Policy
+}
 
-func Init() {
-	if !cmd.IsDebug() {
+// New creates a server from opts.
+func New(opts Options) *Server {
+	if !opts.Debug {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	l := opts.Log
+	if l == nil {
+		l = log.Default()
+	}
+
+	s := &Server{opts: opts}
+
 	r := gin.New()
-	r.Use(gin.Recovery())
-	r.Use(log.Logger())
-	r.Use(Check())
+	r.Use(s.bind)
+	r.Use(l.Middleware())
+	r.Use(Recovery(l, s.reportPanic))
+	r.Use(s.checkOther)
+	s.router = r
 
-	router = r
+	if opts.DocsPath != "" {
+		r.GET(opts.DocsPath, s.serveDocs)
+	}
+
+	return s
 }
 
+// Init creates the default server from the flags read by cmd.Init and the
+// default consul client.
+func Init() {
+	cf := cmd.GetCmdFlag()
+	if cf == nil {
+		panic("init server:cmd is not initialized")
+	}
+
+	opts := Options{
+		Name:          cf.ServerName,
+		Port:          cf.ServerPort,
+		Debug:         cf.Debug,
+		Consul:        consul.GetConsulClient(),
+		StatusMapping: cf.StatusMapping,
+	}
+	if cf.Docs {
+		opts.DocsPath = fmt.Sprintf("/api/%s/openapi.json", cf.ServerName)
+	}
+
+	if err := initTLS(&opts, cf); err != nil {
+		panic(fmt.Sprintf("init server:%v", err))
+	}
+
+	std = New(opts)
+}
+
+// clientAuth are the values of CmdFlag.TLSClientAuth.
+var clientAuth = map[string]tls.ClientAuthType{
+	"":         tls.NoClientCert,
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+// initTLS loads the certificates named by cf from files, or from consul
+// when TLSFromConsul is set. TLS is off when neither is configured.
+func initTLS(opts *Options, cf *cmd.CmdFlag) error {
+	var src certs.Source
+	switch {
+	case cf.TLSFromConsul:
+		if opts.Consul == nil {
+			return fmt.Errorf("tls:consul is not initialized")
+		}
+		src = certs.NewConsul(opts.Consul, "")
+	case cf.TLSCertFile != "":
+		src = certs.Files{Cert: cf.TLSCertFile, Key: cf.TLSKeyFile, CA: cf.TLSCAFile}
+	default:
+		return nil
+	}
+
+	ca, ok := clientAuth[cf.TLSClientAuth]
+	if !ok {
+		return fmt.Errorf("tls:unknown client auth %q", cf.TLSClientAuth)
+	}
+
+	store, err := certs.New(src, time.Minute)
+	if err != nil {
+		return fmt.Errorf("tls:%v", err)
+	}
+
+	opts.TLS, opts.ClientAuth = store, ca
+	return nil
+}
+
+// Default returns the server used by the package-level functions.
+func Default() *Server {
+	if std == nil {
+		panic("server is not initialized")
+	}
+
+	return std
+}
+
+// SetDefault replaces the server used by the package-level functions.
+func SetDefault(s *Server) {
+	std = s
+}
+
+// GetRouter returns the gin engine of the default server. Routes added on
+// it directly are checked with the policy of their path, as set by
+// SetPolicy and Options.Policy, but the other route options, such as
+// Timeout, need Register.
 func GetRouter() *gin.Engine {
-	return router
+	return Default().Router()
 }
 
 func Start() {
-	cc := consul.GetConsulClient()
-	cc.Register()
+	Default().Start()
+}
 
-	cf := cmd.GetCmdFlag()
-	server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", cf.ServerPort),
-		Handler: router,
+func Stop() {
+	Default().Stop()
+}
+
+func Register(version, method, source string, callback func(*gin.Context), opts ...RouteOption) {
+	Default().Register(version, method, source, callback, opts...)
+}
+
+// SetPanicReporter sets the reporter of the panics recovered in the
+// handlers of the default server.
+func SetPanicReporter(report PanicReporter) {
+	Default().SetPanicReporter(report)
+}
+
+// SetPanicReporter sets the reporter of the panics recovered in handlers.
+// Like the other options, it should be set before Start.
+func (s *Server) SetPanicReporter(report PanicReporter) {
+	s.opts.ReportPanic = report
+}
+
+func (s *Server) reportPanic(c *gin.Context, recovered interface{}, stack []byte) {
+	if s.opts.ReportPanic != nil {
+		s.opts.ReportPanic(c, recovered, stack)
 	}
+}
 
-	log.Info("Server is listening on ", cf.ServerPort)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		cc.Deregister()
+// bind makes s reachable from the handlers of its requests.
+func (s *Server) bind(c *gin.Context) {
+	c.Set(serverKey, s)
+}
+
+// fromContext returns the server handling c, or nil outside a Server.
+func fromContext(c *gin.Context) *Server {
+	if s, ok := c.Get(serverKey); ok {
+		return s.(*Server)
+	}
+
+	return nil
+}
+
+// PeerCertificate returns the client certificate of a mutual TLS request
+// once verified against the CA bundle, or nil. Certificates merely
+// requested, as with tls.RequestClientCert, are not returned.
+func PeerCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
+// failStatus is the HTTP status of a response carrying err.
+func failStatus(c *gin.Context, err *terr.TError) int {
+	if s := fromContext(c); s != nil && s.opts.StatusMapping {
+		return err.HTTPStatus()
+	}
+
+	return http.StatusOK
+}
+
+// Router returns the gin engine of s, see GetRouter.
+func (s *Server) Router() *gin.Engine {
+	return s.router
+}
+
+// ServeHTTP lets s be used as an http.Handler, e.g. with httptest.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.router.ServeHTTP(w, req)
+}
+
+// Start registers the service in consul and serves until Stop is called.
+func (s *Server) Start() {
+	cc := s.opts.Consul
+	if cc != nil {
+		cc.Register()
+	}
+
+	s.server = &http.Server{
+		Addr:         fmt.Sprintf(":%d", s.opts.Port),
+		Handler:      s.router,
+		ReadTimeout:  serverTimeout(s.opts.ReadTimeout, defaultReadTimeout),
+		WriteTimeout: serverTimeout(s.opts.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:  serverTimeout(s.opts.IdleTimeout, defaultIdleTimeout),
+	}
+
+	var err error
+	if s.opts.TLS != nil {
+		s.server.TLSConfig = s.opts.TLS.ServerConfig(s.opts.ClientAuth)
+		log.Info("Server is listening with TLS on ", s.opts.Port)
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		log.Info("Server is listening on ", s.opts.Port)
+		err = s.server.ListenAndServe()
+	}
+
+	if err != nil && err != http.ErrServerClosed {
+		if cc != nil {
+			cc.Deregister()
+		}
 		log.Fatal(err)
 	}
 }
 
-func Stop() {
-	cc := consul.GetConsulClient()
-	cc.Deregister()
+// Stop deregisters the service, gracefully shuts the server down, stops
+// reloading the TLS certificates and flushes the logs.
+func (s *Server) Stop() {
+	defer s.flushLogs()
+	if s.opts.TLS != nil {
+		defer s.opts.TLS.Close()
+	}
+
+	if cc := s.opts.Consul; cc != nil {
+		cc.Deregister()
+	}
+
+	if s.server == nil {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
+	if err := s.server.Shutdown(ctx); err != nil {
 		log.Fatal("Server Shutdown:", err)
 	}
 	log.Info("Server exiting")
 }
 
-func Register(version, method, source string, callback func(*gin.Context)) {
-	cf := cmd.GetCmdFlag()
-	url := fmt.Sprintf("/api/%s/%s%s", cf.ServerName, version, source)
-
-	switch method {
-	case "GET":
-		router.GET(url, callback)
-	case "POST":
-		router.POST(url, callback)
-	case "PUT":
-		router.PUT(url, callback)
-	case "PATCH":
-		router.PATCH(url, callback)
-	case "DELETE":
-		router.DELETE(url, callback)
-	default:
-		panic(fmt.Sprintf("unsupported method: %s", method))
+// flushLogs writes what async loggers still queue before the process
+// exits.
+func (s *Server) flushLogs() {
+	if s.opts.Log != nil {
+		s.opts.Log.Flush()
 	}
+	log.Flush()
+}
+
+// Register adds a route under /api/<name>/<version><source>. It panics if
+// the method is unsupported or the route is already registered.
+func (s *Server) Register(version, method, source string, callback func(*gin.Context), opts ...RouteOption) {
+	s.register(version, "", nil, method, source, callback, opts)
 }
 
 func OK(c *gin.Context, data interface{}) {
@@ -113,7 +363,7 @@ func OK(c *gin.Context, data interface{}) {
 func Fail(c *gin.Context, err *terr.TError) {
 	c.Header("Request-Id", c.GetHeader("Request-Id"))
 
-	c.JSON(http.StatusOK, &Response{
+	c.JSON(failStatus(c, err), &Response{
 		Common: &Common{
 			MsgType:   "response",
 			Timestamp: utils.GetNowTs(),
@@ -125,7 +375,7 @@ func Fail(c *gin.Context, err *terr.TError) {
 
 func Abort(c *gin.Context, err *terr.TError) {
 	c.Header("Request-Id", c.GetHeader("Request-Id"))
-	c.AbortWithStatusJSON(http.StatusOK, &Response{
+	c.AbortWithStatusJSON(failStatus(c, err), &Response{
 		Common: &Common{
 			MsgType:   "response",
 			Timestamp: utils.GetNowTs(),
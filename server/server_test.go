@@ -0,0 +1,395 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+)
+
+const body = `{"common":{"msgType":"request","timestamp":1},"param":{}}`
+
+func do(t *testing.T, h http.Handler, method, url, body string) *Response {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	r := &Response{}
+	if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+
+	return r
+}
+
+func TestServersSideBySide(t *testing.T) {
+	a := New(Options{Name: "a"})
+	b := New(Options{Name: "b"})
+
+	a.Register("v1", "POST", "/who", func(c *gin.Context) { OK(c, "a") })
+	b.Register("v1", "POST", "/who", func(c *gin.Context) { OK(c, "b") })
+
+	if r := do(t, a, "POST", "/api/a/v1/who", body); r.Data != "a" {
+		t.Errorf("a answered %v", r.Data)
+	}
+	if r := do(t, b, "POST", "/api/b/v1/who", body); r.Data != "b" {
+		t.Errorf("b answered %v", r.Data)
+	}
+}
+
+type greetReq struct {
+	Name  string `mapstructure:"name" validate:"required"`
+	Times int    `mapstructure:"times" validate:"gte=0"`
+}
+
+type greetResp struct {
+	Message string `json:"message"`
+}
+
+var errNobody = &terr.TError{Code: 30000, Desc: "nobody"}
+
+func greet(ctx context.Context, req *greetReq) (*greetResp, *terr.TError) {
+	if req.Name == "nobody" {
+		return nil, errNobody
+	}
+
+	return &greetResp{Message: strings.Repeat("hi "+req.Name+" ", req.Times)}, nil
+}
+
+func TestHandle(t *testing.T) {
+	s := New(Options{Name: "a"})
+	s.Handle("v1", "POST", "/greet", greet)
+
+	cases := []struct {
+		param string
+		code  int
+		msg   string
+	}{
+		{`{"name":"tink","times":1}`, 0, "hi tink "},
+		{`{"name":"nobody"}`, errNobody.Code, ""},
+		{`{"times":1}`, terr.ErrRequest.Code, ""},
+		{`{"name":1}`, terr.ErrRequest.Code, ""},
+	}
+
+	for _, tc := range cases {
+		body := `{"common":{"msgType":"request","timestamp":1},"param":` + tc.param + `}`
+		r := do(t, s, "POST", "/api/a/v1/greet", body)
+		if r.ErrorCode != tc.code {
+			t.Errorf("%s: errorCode = %d (%s), want %d", tc.param, r.ErrorCode, r.ErrorMsg, tc.code)
+			continue
+		}
+		if data, _ := r.Data.(map[string]interface{}); tc.msg != "" && data["message"] != tc.msg {
+			t.Errorf("%s: data = %v", tc.param, r.Data)
+		}
+	}
+}
+
+func TestTypedShape(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Typed to panic on a bad signature")
+		}
+	}()
+
+	Typed(func(c *gin.Context) {})
+}
+
+// profile is read with mapstructure as a Param and written with json,
+// which flattens Audit while mapstructure only flattens Contact.
+type profile struct {
+	Audit
+	Contact `mapstructure:",squash"`
+	Name    string `mapstructure:"name" json:"fullName"`
+}
+
+type Audit struct {
+	By string `mapstructure:"by" json:"by"`
+}
+
+type Contact struct {
+	Email string `mapstructure:"email" json:"email"`
+}
+
+func echoProfile(ctx context.Context, req *profile) (*profile, *terr.TError) {
+	return req, nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := New(Options{Name: "a", DocsPath: "/api/a/openapi.json"})
+	s.Handle("v1", "POST", "/greet/:id", greet, Summary("Greet someone"), Errors(errNobody))
+	s.Handle("v1", "POST", "/profile", echoProfile)
+	s.Register("v1", "DELETE", "/greet", func(c *gin.Context) { OK(c, nil) })
+
+	req := httptest.NewRequest("GET", "/api/a/openapi.json", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	op, ok := paths["/api/a/v1/greet/{id}"].(map[string]interface{})["post"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("missing typed operation in %v", paths)
+	}
+	if op["summary"] != "Greet someone" {
+		t.Errorf("summary = %v", op["summary"])
+	}
+	if !strings.Contains(w.Body.String(), `"x-errors":[{"code":30000,"desc":"nobody"}]`) {
+		t.Errorf("missing error codes in %s", w.Body.String())
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	param := schemas["greetReq"].(map[string]interface{})
+	if req := param["required"].([]interface{}); len(req) != 1 || req[0] != "name" {
+		t.Errorf("greetReq.required = %v", req)
+	}
+	if _, ok := schemas["greetResp"].(map[string]interface{})["properties"].(map[string]interface{})["message"]; !ok {
+		t.Errorf("greetResp = %v", schemas["greetResp"])
+	}
+	if _, ok := paths["/api/a/v1/greet"].(map[string]interface{})["delete"]; !ok {
+		t.Errorf("missing untyped operation in %v", paths)
+	}
+
+	var paramProps, respProps map[string]interface{}
+	for _, name := range []string{"profile", "profile2"} {
+		props := schemas[name].(map[string]interface{})["properties"].(map[string]interface{})
+		if _, ok := props["name"]; ok {
+			paramProps = props
+		} else {
+			respProps = props
+		}
+	}
+	if paramProps == nil || respProps == nil {
+		t.Fatalf("profile schemas = %v, %v", schemas["profile"], schemas["profile2"])
+	}
+	if _, ok := paramProps["Audit"]; !ok || paramProps["email"] == nil || paramProps["by"] != nil {
+		t.Errorf("param profile = %v", paramProps)
+	}
+	if respProps["fullName"] == nil || respProps["by"] == nil || respProps["email"] == nil || respProps["Audit"] != nil {
+		t.Errorf("response profile = %v", respProps)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var trace []string
+	mark := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) { trace = append(trace, name) }
+	}
+
+	s := New(Options{Name: "a"})
+	g := s.Group("v2", mark("group")).Group("/rooms", mark("rooms"))
+	g.Register("POST", "/list", func(c *gin.Context) { OK(c, "rooms") }, Middleware(mark("route")))
+	g.Register("HEAD", "/list", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	if r := do(t, s, "POST", "/api/a/v2/rooms/list", body); r.Data != "rooms" {
+		t.Errorf("data = %v", r.Data)
+	}
+	if got := strings.Join(trace, ","); got != "group,rooms,route" {
+		t.Errorf("middleware ran as %s", got)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("HEAD", "/api/a/v2/rooms/list", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("HEAD status = %d", w.Code)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	s := New(Options{Name: "a"})
+	s.Register("v1", "ANY", "/x", func(c *gin.Context) {})
+
+	defer func() {
+		r := recover()
+		if msg, _ := r.(string); !strings.Contains(msg, "duplicate route") {
+			t.Errorf("recovered %v", r)
+		}
+	}()
+
+	s.Register("v1", "GET", "/x", func(c *gin.Context) {})
+}
+
+func TestPolicies(t *testing.T) {
+	s := New(Options{Name: "a"})
+	s.SetPolicy("/api/a/v1/hooks", PolicyRawJSON)
+	s.Handle("v1", "GET", "/greet", greet, WithPolicy(PolicyQuery))
+	s.Register("v1", "POST", "/hooks/pay", func(c *gin.Context) { OK(c, c.GetStringMap("param")["id"]) })
+	s.Register("v1", "GET", "/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") }, WithPolicy(PolicyNone))
+	s.Register("v1", "GET", "/page", func(c *gin.Context) {
+		pi, err := GetPageInfo(c)
+		if err != nil {
+			Fail(c, err)
+			return
+		}
+		OK(c, pi.PageIndex*1000+pi.PageSize)
+	}, WithPolicy(PolicyQuery))
+	// Routes added on the router get the policy of their path.
+	s.Router().POST("/api/a/legacy/:id", func(c *gin.Context) { OK(c, c.GetStringMap("param")["name"]) })
+	s.Router().POST("/api/a/v1/hooks/legacy", func(c *gin.Context) { OK(c, c.GetStringMap("param")["id"]) })
+
+	r := do(t, s, "GET", "/api/a/v1/greet?name=tink&times=2", "")
+	if data, _ := r.Data.(map[string]interface{}); data["message"] != "hi tink hi tink " {
+		t.Errorf("query: %d %s %v", r.ErrorCode, r.ErrorMsg, r.Data)
+	}
+
+	if r := do(t, s, "POST", "/api/a/v1/hooks/pay", `{"id":"x1"}`); r.Data != "x1" {
+		t.Errorf("raw json: %d %s %v", r.ErrorCode, r.ErrorMsg, r.Data)
+	}
+
+	if r := do(t, s, "POST", "/api/a/legacy/1", `{"common":{"msgType":"request","timestamp":1},"param":{"name":"tink"}}`); r.Data != "tink" {
+		t.Errorf("router envelope: %d %s %v", r.ErrorCode, r.ErrorMsg, r.Data)
+	}
+	if r := do(t, s, "POST", "/api/a/legacy/1", `{"name":"tink"}`); r.ErrorCode != terr.ErrRequest.Code {
+		t.Errorf("router without envelope: %d", r.ErrorCode)
+	}
+	if r := do(t, s, "POST", "/api/a/v1/hooks/legacy", `{"id":"x2"}`); r.Data != "x2" {
+		t.Errorf("router raw json: %d %s %v", r.ErrorCode, r.ErrorMsg, r.Data)
+	}
+
+	if r := do(t, s, "GET", "/api/a/v1/page?pageIndex=2&pageSize=20", ""); r.Data != float64(2020) {
+		t.Errorf("page: %d %s %v", r.ErrorCode, r.ErrorMsg, r.Data)
+	}
+	if r := do(t, s, "GET", "/api/a/v1/page?pageIndex=x&pageSize=20", ""); r.ErrorCode != terr.ErrRequest.Code {
+		t.Errorf("bad page: %d", r.ErrorCode)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/api/a/v1/health", nil))
+	if w.Body.String() != "ok" {
+		t.Errorf("none: %q", w.Body.String())
+	}
+}
+
+func TestStatusMapping(t *testing.T) {
+	for _, mapping := range []bool{false, true} {
+		s := New(Options{Name: "a", StatusMapping: mapping})
+		s.Handle("v1", "POST", "/greet", greet)
+		s.Register("v1", "POST", "/conflict", func(c *gin.Context) {
+			Fail(c, errNobody.WithStatus(http.StatusConflict))
+		})
+
+		cases := map[string]int{
+			`{"common":{"msgType":"request","timestamp":1},"param":{"name":"tink"}}`: http.StatusOK,
+			`{"common":{"msgType":"request","timestamp":1},"param":{}}`:              http.StatusBadRequest,
+			`{"param":{}}`: http.StatusBadRequest,
+			// service codes from 30000, as in scaffolded services
+			`{"common":{"msgType":"request","timestamp":1},"param":{"name":"nobody"}}`: http.StatusBadRequest,
+		}
+		for body, status := range cases {
+			if !mapping {
+				status = http.StatusOK
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/a/v1/greet", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			s.ServeHTTP(w, req)
+			if w.Code != status {
+				t.Errorf("mapping %v, %s: status = %d, want %d", mapping, body, w.Code, status)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/a/v1/conflict", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.ServeHTTP(w, req)
+		if want := map[bool]int{false: 200, true: 409}[mapping]; w.Code != want {
+			t.Errorf("mapping %v: conflict status = %d", mapping, w.Code)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	var reported interface{}
+	s := New(Options{Name: "a", ReportPanic: func(c *gin.Context, recovered interface{}, stack []byte) {
+		reported = recovered
+	}})
+	s.Register("v1", "POST", "/boom", func(c *gin.Context) { panic("boom") })
+
+	r := do(t, s, "POST", "/api/a/v1/boom", body)
+	if r.ErrorCode != terr.ErrServer.Code {
+		t.Errorf("errorCode = %d", r.ErrorCode)
+	}
+	if reported != "boom" {
+		t.Errorf("reported %v", reported)
+	}
+
+	var replaced interface{}
+	s.SetPanicReporter(func(c *gin.Context, recovered interface{}, stack []byte) {
+		replaced = recovered
+	})
+	do(t, s, "POST", "/api/a/v1/boom", body)
+	if replaced != "boom" {
+		t.Errorf("replaced reporter got %v", replaced)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := New(Options{Name: "a", Timeout: time.Hour})
+	s.Register("v1", "POST", "/silent", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	}, Timeout(10*time.Millisecond))
+	s.Register("v1", "POST", "/fail", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		Fail(c, ContextError(c.Request.Context().Err(), terr.ErrServer))
+	})
+	s.Register("v1", "POST", "/fast", func(c *gin.Context) {
+		OK(c, nil)
+	}, Timeout(time.Second))
+	s.Register("v1", "POST", "/deaf", func(c *gin.Context) {
+		time.Sleep(300 * time.Millisecond)
+		Fail(c, terr.ErrConsul)
+	}, Timeout(10*time.Millisecond))
+	s.Register("v1", "POST", "/consul", func(c *gin.Context) {
+		Fail(c, terr.ErrConsul)
+	}, Timeout(time.Second))
+
+	if r := do(t, s, "POST", "/api/a/v1/silent", body); r.ErrorCode != int(terr.ErrTimeout.Code) {
+		t.Errorf("silent: %+v", r)
+	}
+
+	// The caller's header shortens the server timeout.
+	req := httptest.NewRequest("POST", "/api/a/v1/fail", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimeoutHeader, "10")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"errorCode":10002`) {
+		t.Errorf("fail: %s", w.Body.String())
+	}
+
+	if r := do(t, s, "POST", "/api/a/v1/fast", body); r.ErrorCode != 0 {
+		t.Errorf("fast: %+v", r)
+	}
+	if r := do(t, s, "POST", "/api/a/v1/consul", body); r.ErrorCode != int(terr.ErrConsul.Code) {
+		t.Errorf("consul: %+v", r)
+	}
+
+	// A handler ignoring its context does not hold the answer back.
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	start := time.Now()
+	resp, err := http.Post(ts.URL+"/api/a/v1/deaf", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("deaf answered after %v", elapsed)
+	}
+	if !strings.Contains(string(b), `"errorCode":10002`) {
+		t.Errorf("deaf: %s", b)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	terr "github.com/tinklabs/golibs/error"
+	"github.com/tinklabs/golibs/utils"
+)
+
+// TimeoutHeader carries the time left to answer a request, in
+// milliseconds. The client package sets it from the deadline of its
+// context, so a service never works longer than its caller waits.
+const TimeoutHeader = "X-Request-Timeout"
+
+// Defaults of the http.Server timeouts, see Options.
+const (
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 60 * time.Second
+	defaultIdleTimeout  = 120 * time.Second
+)
+
+// serverTimeout is d, or def when d is zero. Negative durations disable
+// the timeout.
+func serverTimeout(d, def time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d == 0:
+		return def
+	}
+
+	return d
+}
+
+// deadline puts a deadline on the request context of rt, from the route
+// timeout or the server timeout and the TimeoutHeader of the caller,
+// whichever is shorter. Handlers pass c.Request.Context() down to the db,
+// cache and client calls.
+//
+// The later handlers run in a goroutine with their response buffered. When
+// the deadline passes first, the caller is answered with ErrTimeout at once
+// and what the handlers write afterwards is dropped. They still run until
+// they return, so handlers should give up once the context is done.
+func (s *Server) deadline(rt *route) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := rt.timeout
+		if timeout == 0 {
+			timeout = s.opts.Timeout
+		}
+
+		if ms, err := strconv.ParseInt(c.GetHeader(TimeoutHeader), 10, 64); err == nil && ms > 0 {
+			if d := time.Duration(ms) * time.Millisecond; timeout <= 0 || d < timeout {
+				timeout = d
+			}
+		}
+
+		if timeout <= 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		// Computed before the handlers share c with another goroutine.
+		status := failStatus(c, terr.ErrTimeout)
+		requestID := c.GetHeader("Request-Id")
+
+		w := c.Writer
+		tw := &timeoutWriter{ResponseWriter: w, header: http.Header{}, status: http.StatusOK}
+		for k, v := range w.Header() {
+			tw.header[k] = v
+		}
+		c.Writer = tw
+
+		done := make(chan struct{})
+		var recovered interface{}
+		go func() {
+			defer close(done)
+			defer func() { recovered = recover() }()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+			// A handler returning without an answer past the deadline.
+			if ctx.Err() == context.DeadlineExceeded && !tw.Written() {
+				tw.timeOut()
+				writeTimeout(w, status, requestID)
+			}
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				tw.timeOut()
+				writeTimeout(w, status, requestID)
+			}
+			<-done
+		}
+
+		c.Writer = w
+		if recovered != nil {
+			// Recovery, which runs in this goroutine, handles it.
+			panic(recovered)
+		}
+		tw.copyTo(w)
+		c.Abort()
+	}
+}
+
+// writeTimeout answers ErrTimeout on w, without the gin context the
+// handlers still use.
+func writeTimeout(w gin.ResponseWriter, status int, requestID string) {
+	b, _ := json.Marshal(&Response{
+		Common: &Common{
+			MsgType:   "response",
+			Timestamp: utils.GetNowTs(),
+		},
+		ErrorCode: int(terr.ErrTimeout.Code),
+		ErrorMsg:  terr.ErrTimeout.Message(),
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.Header().Set("Request-Id", requestID)
+	w.WriteHeader(status)
+	w.Write(b)
+	w.Flush()
+}
+
+// timeoutWriter buffers the response of handlers under a deadline, and
+// drops it once the deadline has been answered.
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	written  bool
+	body     bytes.Buffer
+	timedOut bool
+}
+
+// timeOut drops what was buffered and what is written later.
+func (w *timeoutWriter) timeOut() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timedOut = true
+	w.body.Reset()
+}
+
+func (w *timeoutWriter) copyTo(dst gin.ResponseWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	for k, v := range w.header {
+		dst.Header()[k] = v
+	}
+	if !w.written {
+		return
+	}
+	dst.WriteHeader(w.status)
+	dst.WriteHeaderNow()
+	dst.Write(w.body.Bytes())
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.body.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.written
+}
+
+// Flush is a no-op: the response is sent when the handlers return.
+func (w *timeoutWriter) Flush() {}
+
+// ContextError returns ErrTimeout when err is the error of a request
+// context past its deadline, as returned by the db, cache and client calls
+// given that context, and fallback otherwise:
+//
+//	if err != nil {
+//		server.Fail(c, server.ContextError(err, errcode.ErrDB))
+//	}
+func ContextError(err error, fallback *terr.TError) *terr.TError {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	if err == context.DeadlineExceeded {
+		return terr.ErrTimeout
+	}
+
+	return fallback
+}
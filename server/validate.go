@@ -53,54 +53,6 @@ func GetPageInfo(c *gin.Context) (*PageInfo, *terr.TError) {
 	return pi, nil
 }
 
-func Check() gin.HandlerFunc {
-
-	return func(c *gin.Context) {
-
-		if c.ContentType() == "multipart/form-data" {
-			c.Next()
-			return
-		}
-
-		r := Request{}
-		if err := c.ShouldBindJSON(&r); err != nil {
-			log.Warn(err)
-			Abort(c, terr.ErrRequest.AddExtra("json format is incorrect"))
-			return
-		}
-
-		if err := validate.Struct(&r); err != nil {
-			log.Warn(err)
-			Abort(c, terr.ErrRequest.AddExtra("common and param is required"))
-			return
-		}
-
-		if v, isExist := r.Param["pageIndex"]; isExist {
-			if v, ok := v.(float64); !ok {
-				log.Error("pageIndex type is wrong")
-				Abort(c, terr.ErrRequest.AddExtra("pageIndex type should be int"))
-				return
-			} else {
-				c.Set("pageIndex", int(v))
-			}
-		}
-
-		if v, isExist := r.Param["pageSize"]; isExist {
-			if v, ok := v.(float64); !ok {
-				log.Error("pagSize type is wrong")
-				Abort(c, terr.ErrRequest.AddExtra("pageSize type should be int"))
-				return
-			} else {
-				c.Set("pageSize", int(v))
-			}
-		}
-
-		c.Set("param", r.Param)
-
-		c.Next()
-	}
-}
-
 func Validate(s interface{}) error {
 	if err := validate.Struct(s); err != nil {
 		return err
@@ -5,10 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"reflect"
@@ -19,6 +17,8 @@ import (
 	"github.com/gofrs/uuid"
 	"github.com/mitchellh/mapstructure"
 	"github.com/shopspring/decimal"
+
+	"github.com/tinklabs/golibs/metadata"
 )
 
 var letterRunes = []rune("1234567890")
@@ -41,7 +41,7 @@ func UUID() (string, error) {
 }
 
 func Quit() chan os.Signal {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
 	return quit
@@ -116,6 +116,16 @@ func SnameMapKey(m map[string]interface{}) map[string]interface{} {
 }
 
 func Decode(source map[string]interface{}, target interface{}) error {
+	return decode(source, target, false)
+}
+
+// WeakDecode is Decode with weakly typed input, e.g. strings from a query
+// string into int or bool fields.
+func WeakDecode(source map[string]interface{}, target interface{}) error {
+	return decode(source, target, true)
+}
+
+func decode(source map[string]interface{}, target interface{}, weak bool) error {
 	customHook := func(
 		f reflect.Type,
 		t reflect.Type,
@@ -136,8 +146,9 @@ func Decode(source map[string]interface{}, target interface{}) error {
 	}
 
 	config := mapstructure.DecoderConfig{
-		DecodeHook: customHook,
-		Result:     &target,
+		DecodeHook:       customHook,
+		WeaklyTypedInput: weak,
+		Result:           &target,
 	}
 
 	decoder, err := mapstructure.NewDecoder(&config)
@@ -175,17 +186,15 @@ func GetIntranetIp(dontCheckPrefix bool) string {
 	panic("cant find intranet ip")
 }
 
+// GetConsulAddressFromMetadata returns the consul agent address of the
+// EC2 host the service runs on.
+//
+// Deprecated: use a metadata.Provider, which has timeouts and retries.
 func GetConsulAddressFromMetadata() string {
-	resp, err := http.Get("http://169.254.169.254/latest/meta-data/local-ipv4")
+	ip, err := (&metadata.AWS{}).LocalIPv4()
 	if err != nil {
 		panic(fmt.Sprintf("get meta:%v", err))
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(fmt.Sprintf("read meta:%v", err))
-	}
 
-	return fmt.Sprintf("http://%s", string(body))
+	return fmt.Sprintf("http://%s", ip)
 }